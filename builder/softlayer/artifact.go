@@ -2,15 +2,28 @@ package softlayer
 
 import (
 	"fmt"
+	"github.com/mitchellh/packer/packer"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Artifact represents a Softlayer image as the result of a Packer build.
 type Artifact struct {
-	imageName      string
-	imageId        string
-	datacenterName string
-	client         *SoftlayerClient
+	imageName       string
+	imageId         string
+	templateGroupId int64
+	sourceImageId   string
+	sourceOsCode    string
+	instanceId      string
+	imageTags       []string
+	datacenters     []string
+	sharedAccounts  []int
+	files           []string
+	cost            float64
+	stateTimeout    time.Duration
+	client          *SoftlayerClient
 }
 
 // BuilderId returns the builder Id.
@@ -21,25 +34,114 @@ func (*Artifact) BuilderId() string {
 // Destroy destroys the Softlayer image represented by the artifact.
 func (self *Artifact) Destroy() error {
 	log.Printf("Destroying image: %s", self.String())
-	err := self.client.destroyImage(self.imageId)
-	return err
-}
 
-// Files returns the files represented by the artifact.
-func (*Artifact) Files() []string {
+	var errs []error
+
+	// Revoke the access of the accounts the image was shared with, the image is deleted anyway
+	for _, accountId := range self.sharedAccounts {
+		log.Printf("Stopping to share image (%s) with account %d", self.imageId, accountId)
+		if err := self.client.denyImageSharing(self.templateGroupId, accountId); err != nil {
+			errs = append(errs, fmt.Errorf("Error stopping to share image (%s) with account %d: %s", self.imageId, accountId, err))
+		}
+	}
+
+	if err := self.client.destroyImage(self.imageId, self.stateTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return &packer.MultiError{Errors: errs}
+	}
+
 	return nil
 }
 
+// Files returns the files represented by the artifact, the locations the image was exported to.
+func (self *Artifact) Files() []string {
+	return self.files
+}
+
 // Id returns the Softlayer image ID.
 func (self *Artifact) Id() string {
 	return self.imageId
 }
 
+// State returns additional information about the image. Supported keys are:
+//   "tags" - the tags applied to the image ([]string)
+//   "image_name" - the name of the image (string)
+//   "image_id" - the global id (UUID) of the image, same as Id() (string)
+//   "template_group_id" - the numeric id of the image's block device template group (int64)
+//   "source_image_id" - the global id of the image the build started from, if it didn't start from an OS (string)
+//   "source_os_code" - the reference code of the operating system the build started from, if known (string)
+//   "instance_id" - the global id of the instance the image was captured from (string)
+//   "datacenters" - every datacenter the image is available in ([]string)
+//   "shared_accounts" - the ids of the accounts the image is shared with ([]int)
+//   "cost" - the estimated cost of the build instance (float64)
+//   "atlas.artifact.metadata" - the values above, flattened to strings (map[string]string)
 func (self *Artifact) State(name string) interface{} {
+	switch name {
+	case "tags":
+		return self.imageTags
+	case "image_name":
+		return self.imageName
+	case "image_id":
+		return self.imageId
+	case "template_group_id":
+		return self.templateGroupId
+	case "source_image_id":
+		return self.sourceImageId
+	case "source_os_code":
+		return self.sourceOsCode
+	case "instance_id":
+		return self.instanceId
+	case "datacenters":
+		return self.datacenters
+	case "shared_accounts":
+		return self.sharedAccounts
+	case "cost":
+		return self.cost
+	case "atlas.artifact.metadata":
+		return self.metadata()
+	}
+
 	return nil
 }
 
+// metadata returns the artifact's generated data as a flat map of strings.
+func (self *Artifact) metadata() map[string]string {
+	metadata := map[string]string{
+		"image_name":        self.imageName,
+		"image_id":          self.imageId,
+		"template_group_id": strconv.FormatInt(self.templateGroupId, 10),
+		"datacenters":       strings.Join(self.datacenters, ","),
+		"tags":              strings.Join(self.imageTags, ","),
+		"cost":              strconv.FormatFloat(self.cost, 'f', 4, 64),
+	}
+
+	if self.sourceImageId != "" {
+		metadata["source_image_id"] = self.sourceImageId
+	}
+
+	if self.sourceOsCode != "" {
+		metadata["source_os_code"] = self.sourceOsCode
+	}
+
+	if self.instanceId != "" {
+		metadata["instance_id"] = self.instanceId
+	}
+
+	if len(self.sharedAccounts) > 0 {
+		accounts := make([]string, len(self.sharedAccounts))
+		for i, accountId := range self.sharedAccounts {
+			accounts[i] = strconv.Itoa(accountId)
+		}
+		metadata["shared_accounts"] = strings.Join(accounts, ",")
+	}
+
+	return metadata
+}
+
 // String returns the string representation of the artifact.
 func (self *Artifact) String() string {
-	return fmt.Sprintf("%s::%s (%s)", self.datacenterName, self.imageId, self.imageName)
+	return fmt.Sprintf("%s::%s (%s)", strings.Join(self.datacenters, ","), self.imageId, self.imageName)
 }
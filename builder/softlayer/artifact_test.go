@@ -0,0 +1,86 @@
+package softlayer
+
+import (
+	"github.com/mitchellh/packer/packer"
+	"reflect"
+	"testing"
+)
+
+func testArtifact() *Artifact {
+	return &Artifact{
+		imageName:       "centos-golden",
+		imageId:         "0b4b3c3e-0c1b-4d8a-9f4e-5c7a8d6e2f10",
+		templateGroupId: 1234,
+		sourceImageId:   "",
+		sourceOsCode:    "CENTOS_7_64",
+		instanceId:      "6f0a7e2b-1d9c-4f2e-8a3b-9c4d5e6f7a8b",
+		imageTags:       []string{"nightly", "centos"},
+		datacenters:     []string{"ams01", "dal10"},
+		sharedAccounts:  []int{4321},
+		cost:            0.25,
+	}
+}
+
+func TestArtifact_Impl(t *testing.T) {
+	var _ packer.Artifact = new(Artifact)
+}
+
+func TestArtifact_State(t *testing.T) {
+	a := testArtifact()
+
+	expected := map[string]interface{}{
+		"image_name":        "centos-golden",
+		"image_id":          "0b4b3c3e-0c1b-4d8a-9f4e-5c7a8d6e2f10",
+		"template_group_id": int64(1234),
+		"tags":              []string{"nightly", "centos"},
+		"source_image_id":   "",
+		"source_os_code":    "CENTOS_7_64",
+		"instance_id":       "6f0a7e2b-1d9c-4f2e-8a3b-9c4d5e6f7a8b",
+		"datacenters":       []string{"ams01", "dal10"},
+		"shared_accounts":   []int{4321},
+		"cost":              0.25,
+	}
+
+	for key, value := range expected {
+		if state := a.State(key); !reflect.DeepEqual(state, value) {
+			t.Fatalf("Expected state '%s' to be %#v but got %#v", key, value, state)
+		}
+	}
+
+	if state := a.State("unknown"); state != nil {
+		t.Fatalf("Expected nil for an unknown key but got %#v", state)
+	}
+}
+
+func TestArtifact_StateMetadata(t *testing.T) {
+	a := testArtifact()
+
+	expected := map[string]string{
+		"image_name":        "centos-golden",
+		"image_id":          "0b4b3c3e-0c1b-4d8a-9f4e-5c7a8d6e2f10",
+		"template_group_id": "1234",
+		"tags":              "nightly,centos",
+		"source_os_code":    "CENTOS_7_64",
+		"instance_id":       "6f0a7e2b-1d9c-4f2e-8a3b-9c4d5e6f7a8b",
+		"datacenters":       "ams01,dal10",
+		"shared_accounts":   "4321",
+		"cost":              "0.2500",
+	}
+
+	metadata := a.State("atlas.artifact.metadata")
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Fatalf("Unexpected metadata: %#v", metadata)
+	}
+}
+
+func TestArtifact_Files(t *testing.T) {
+	a := testArtifact()
+	if a.Files() != nil {
+		t.Fatalf("Expected no files but got %v", a.Files())
+	}
+
+	a.files = []string{"cos://us-south/golden-images/centos-golden.vhd"}
+	if len(a.Files()) != 1 || a.Files()[0] != a.files[0] {
+		t.Fatalf("Unexpected files: %v", a.Files())
+	}
+}
@@ -0,0 +1,79 @@
+package softlayer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BastionLookupConfig selects the bastion instance among the instances of the account.
+type BastionLookupConfig struct {
+	Hostname string `mapstructure:"hostname"`
+	Tag      string `mapstructure:"tag"`
+
+	// Connect to the bastion on its private address, when the builder runs on the private network
+	UsePrivateIp bool `mapstructure:"use_private_ip"`
+}
+
+// IsSet reports whether any of the options were configured.
+func (self *BastionLookupConfig) IsSet() bool {
+	return *self != BastionLookupConfig{}
+}
+
+// Prepare validates the configuration.
+func (self *BastionLookupConfig) Prepare() []error {
+	var errs []error
+
+	if self.Hostname == "" && self.Tag == "" {
+		errs = append(errs, errors.New("ssh_bastion_lookup must specify a hostname, a tag or both"))
+	}
+
+	return errs
+}
+
+// findBastionAddress returns the address of the instance, out of the instances of the account, selected by the lookup.
+// The hostname matches either the host name or the fully qualified domain name of the instance.
+func findBastionAddress(guests []interface{}, lookup BastionLookupConfig) (string, error) {
+	var matches []map[string]interface{}
+	for _, val := range guests {
+		guest, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if lookup.Hostname != "" && guest["hostname"] != lookup.Hostname && guest["fullyQualifiedDomainName"] != lookup.Hostname {
+			continue
+		}
+
+		if lookup.Tag != "" && !containsString(tagNames(guest), lookup.Tag) {
+			continue
+		}
+
+		matches = append(matches, guest)
+	}
+
+	if len(matches) == 0 {
+		return "", errors.New("No instance matches the ssh_bastion_lookup")
+	}
+
+	if len(matches) > 1 {
+		var names []string
+		for _, guest := range matches {
+			names = append(names, fmt.Sprintf("%v", guest["fullyQualifiedDomainName"]))
+		}
+
+		return "", fmt.Errorf("%d instances match the ssh_bastion_lookup (%s), narrow it down", len(matches), strings.Join(names, ", "))
+	}
+
+	field := "primaryIpAddress"
+	if lookup.UsePrivateIp {
+		field = "primaryBackendIpAddress"
+	}
+
+	address, _ := matches[0][field].(string)
+	if address == "" {
+		return "", fmt.Errorf("The bastion instance (%v) has no %s", matches[0]["fullyQualifiedDomainName"], field)
+	}
+
+	return address, nil
+}
@@ -0,0 +1,47 @@
+package softlayer
+
+import (
+	"testing"
+)
+
+func TestBastion_FindBastionAddress(t *testing.T) {
+	tagged := []interface{}{
+		map[string]interface{}{"tag": map[string]interface{}{"name": "bastion"}},
+	}
+	guests := []interface{}{
+		map[string]interface{}{
+			"hostname": "jump", "fullyQualifiedDomainName": "jump.example.com",
+			"primaryIpAddress": "169.50.1.1", "primaryBackendIpAddress": "10.0.0.1", "tagReferences": tagged,
+		},
+		map[string]interface{}{
+			"hostname": "jump", "fullyQualifiedDomainName": "jump.staging.example.com",
+			"primaryIpAddress": "169.50.1.2", "primaryBackendIpAddress": "10.0.0.2",
+		},
+		map[string]interface{}{
+			"hostname": "web", "fullyQualifiedDomainName": "web.example.com",
+			"primaryBackendIpAddress": "10.0.0.3", "tagReferences": tagged,
+		},
+	}
+
+	address, err := findBastionAddress(guests, BastionLookupConfig{Hostname: "jump.example.com"})
+	if err != nil || address != "169.50.1.1" {
+		t.Fatalf("Expected the public address of jump.example.com but got: '%s', %v", address, err)
+	}
+
+	address, err = findBastionAddress(guests, BastionLookupConfig{Hostname: "jump", Tag: "bastion", UsePrivateIp: true})
+	if err != nil || address != "10.0.0.1" {
+		t.Fatalf("Expected the private address of jump.example.com but got: '%s', %v", address, err)
+	}
+
+	if _, err := findBastionAddress(guests, BastionLookupConfig{Hostname: "jump"}); err == nil {
+		t.Fatal("Expected an error for several matching instances")
+	}
+
+	if _, err := findBastionAddress(guests, BastionLookupConfig{Hostname: "web"}); err == nil {
+		t.Fatal("Expected an error for an instance without a public address")
+	}
+
+	if _, err := findBastionAddress(guests, BastionLookupConfig{Tag: "vpn"}); err == nil {
+		t.Fatal("Expected an error for no matching instance")
+	}
+}
@@ -0,0 +1,50 @@
+package softlayer
+
+import (
+	"github.com/mitchellh/multistep"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tags marking the resources of a build until it succeeds, so that the resources left
+// behind by a crashed build can be cleaned up once they expire
+const BUILD_ID_TAG_PREFIX = "packer-build-id:"
+const BUILD_EXPIRES_TAG_PREFIX = "packer-expires:"
+
+// The defaults of instance_name_prefix and resource_ttl, which the cleanup command uses as well
+const DEFAULT_INSTANCE_NAME_PREFIX = "packer-softlayer"
+const DEFAULT_RESOURCE_TTL = "24h"
+
+// buildTags returns the tags marking the resources of the build.
+func buildTags(state multistep.StateBag) []string {
+	buildId := state.Get("build_id").(string)
+	expiresAt := state.Get("build_expires_at").(time.Time)
+
+	return []string{
+		BUILD_ID_TAG_PREFIX + buildId,
+		BUILD_EXPIRES_TAG_PREFIX + strconv.FormatInt(expiresAt.Unix(), 10),
+	}
+}
+
+// buildExpiry returns the build id and expiry found in the tags of a resource,
+// ok is false for resources not marked by a build.
+func buildExpiry(tags []string) (buildId string, expiresAt time.Time, ok bool) {
+	var expires string
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, BUILD_ID_TAG_PREFIX) {
+			buildId = strings.TrimPrefix(tag, BUILD_ID_TAG_PREFIX)
+		}
+
+		if strings.HasPrefix(tag, BUILD_EXPIRES_TAG_PREFIX) {
+			expires = strings.TrimPrefix(tag, BUILD_EXPIRES_TAG_PREFIX)
+		}
+	}
+
+	timestamp, err := strconv.ParseInt(expires, 10, 64)
+	if buildId == "" || err != nil {
+		return "", time.Time{}, false
+	}
+
+	return buildId, time.Unix(timestamp, 0), true
+}
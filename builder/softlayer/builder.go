@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"github.com/mitchellh/multistep"
 	"github.com/mitchellh/packer/common"
+	"github.com/mitchellh/packer/common/uuid"
 	"github.com/mitchellh/packer/helper/communicator"
 	"github.com/mitchellh/packer/helper/config"
 	"github.com/mitchellh/packer/packer"
 	"github.com/mitchellh/packer/template/interpolate"
 	"log"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -21,6 +24,28 @@ type Config struct {
 	common.PackerConfig `mapstructure:",squash"`
 	Comm                communicator.Config `mapstructure:",squash"`
 
+	// Connect over ssh with the password SoftLayer provisioned the instance with
+	SSHUseProvisionedPassword bool `mapstructure:"ssh_use_provisioned_password"`
+
+	// The ssh key generated for the build when no ssh_private_key_file is given
+	TemporaryKeyType string `mapstructure:"temporary_key_type"`
+	TemporaryKeyBits int    `mapstructure:"temporary_key_bits"`
+	TemporaryKeyFile string `mapstructure:"temporary_key_file"`
+
+	// Existing keys of the account to attach to the instance
+	SSHKeyIds    []int64  `mapstructure:"ssh_key_ids"`
+	SSHKeyLabels []string `mapstructure:"ssh_key_labels"`
+
+	SSHAgentAuth            bool   `mapstructure:"ssh_agent_auth"`
+	SSHPrivateKeyPassphrase string `mapstructure:"ssh_private_key_passphrase"`
+	SSHCertificateFile      string `mapstructure:"ssh_certificate_file"`
+
+	// The expected host key of the instance, otherwise the first one seen is trusted
+	SSHHostKeyFingerprint string `mapstructure:"ssh_host_key_fingerprint"`
+
+	// Reach private instances through a bastion found in the account
+	SSHBastionLookup BastionLookupConfig `mapstructure:"ssh_bastion_lookup"`
+
 	Username         string `mapstructure:"username"`
 	APIKey           string `mapstructure:"api_key"`
 	DatacenterName   string `mapstructure:"datacenter_name"`
@@ -30,16 +55,44 @@ type Config struct {
 	BaseImageId      string `mapstructure:"base_image_id"`
 	BaseOsCode       string `mapstructure:"base_os_code"`
 
+	ImageNameConflict string `mapstructure:"image_name_conflict"`
+
 	InstanceName         string `mapstructure:"instance_name"`
+	InstanceNamePrefix   string `mapstructure:"instance_name_prefix"`
 	InstanceDomain       string `mapstructure:"instance_domain"`
 	InstanceCpu          int    `mapstructure:"instance_cpu"`
 	InstanceMemory       int64  `mapstructure:"instance_memory"`
 	InstanceNetworkSpeed int    `mapstructure:"instance_network_speed"`
 	InstanceDiskCapacity int    `mapstructure:"instance_disk_capacity"`
 
+	InstancePrivateNetworkOnly bool `mapstructure:"instance_private_network_only"`
+
+	DryRun bool `mapstructure:"dry_run"`
+
+	// What to do with the instance of a failed build. PackerOnError is set by packer's -on-error flag.
+	OnError       string `mapstructure:"on_error"`
+	PackerOnError string `mapstructure:"packer_on_error"`
+
+	InstanceTags []string `mapstructure:"instance_tags"`
+	ImageTags    []string `mapstructure:"image_tags"`
+
+	ImageDatacenters   []string `mapstructure:"image_datacenters"`
+	ImageShareAccounts []int    `mapstructure:"image_share_accounts"`
+
+	Export ObjectStorageConfig `mapstructure:"export"`
+
+	BaseImageSource BaseImageSourceConfig `mapstructure:"base_image_source"`
+	BaseImageFilter BaseImageFilterConfig `mapstructure:"base_image_filter"`
+
+	ImageRetention ImageRetentionConfig `mapstructure:"image_retention"`
+
 	RawStateTimeout string `mapstructure:"instance_state_timeout"`
 	StateTimeout    time.Duration
 
+	// How long the resources of a build live if the build crashes
+	RawResourceTTL string `mapstructure:"resource_ttl"`
+	ResourceTTL    time.Duration
+
 	ctx interpolate.Context
 }
 
@@ -47,6 +100,11 @@ type Config struct {
 const IMAGE_TYPE_FLEX = "flex"
 const IMAGE_TYPE_STANDARD = "standard"
 
+// Ways to handle an existing image with the same name
+const IMAGE_NAME_CONFLICT_ERROR = "error"
+const IMAGE_NAME_CONFLICT_REPLACE = "replace"
+const IMAGE_NAME_CONFLICT_SUFFIX = "suffix"
+
 // Builder represents a Packer Builder.
 type Builder struct {
 	config Config
@@ -79,8 +137,15 @@ func (self *Builder) Prepare(raws ...interface{}) (parms []string, retErr error)
 		self.config.DatacenterName = "ams01"
 	}
 
+	if self.config.InstanceNamePrefix == "" {
+		self.config.InstanceNamePrefix = DEFAULT_INSTANCE_NAME_PREFIX
+	}
+
+	// Generated instance names end with a unique suffix
+	var instanceNameSuffix string
 	if self.config.InstanceName == "" {
-		self.config.InstanceName = fmt.Sprintf("packer-softlayer-%s", time.Now().Unix())
+		instanceNameSuffix = "-" + uuid.TimeOrderedUUID()
+		self.config.InstanceName = self.config.InstanceNamePrefix + instanceNameSuffix
 	}
 
 	if self.config.InstanceDomain == "" {
@@ -95,6 +160,10 @@ func (self *Builder) Prepare(raws ...interface{}) (parms []string, retErr error)
 		self.config.ImageType = IMAGE_TYPE_FLEX
 	}
 
+	if self.config.ImageNameConflict == "" {
+		self.config.ImageNameConflict = IMAGE_NAME_CONFLICT_ERROR
+	}
+
 	if self.config.InstanceCpu == 0 {
 		self.config.InstanceCpu = 1
 	}
@@ -111,10 +180,31 @@ func (self *Builder) Prepare(raws ...interface{}) (parms []string, retErr error)
 		self.config.InstanceDiskCapacity = 25
 	}
 
-	if self.config.Comm.SSHUsername == "" {
+	if self.config.Comm.Type == "winrm" {
+		if self.config.Comm.WinRMUser == "" {
+			self.config.Comm.WinRMUser = "Administrator"
+		}
+	} else if self.config.Comm.SSHUsername == "" {
 		self.config.Comm.SSHUsername = "root"
 	}
 
+	if self.config.TemporaryKeyType == "" {
+		self.config.TemporaryKeyType = TEMPORARY_KEY_TYPE_RSA
+	}
+
+	if self.config.TemporaryKeyBits == 0 {
+		switch self.config.TemporaryKeyType {
+		case TEMPORARY_KEY_TYPE_RSA:
+			self.config.TemporaryKeyBits = 2048
+		case TEMPORARY_KEY_TYPE_ECDSA:
+			self.config.TemporaryKeyBits = 256
+		}
+	}
+
+	if self.config.RawResourceTTL == "" {
+		self.config.RawResourceTTL = DEFAULT_RESOURCE_TTL
+	}
+
 	if self.config.RawStateTimeout == "" {
 		self.config.RawStateTimeout = "10m"
 	}
@@ -144,20 +234,177 @@ func (self *Builder) Prepare(raws ...interface{}) (parms []string, retErr error)
 			errs, fmt.Errorf("Unknown image_type '%s'. Must be one of 'flex' (the default) or 'standard'.", self.config.ImageType))
 	}
 
-	if self.config.BaseImageId == "" && self.config.BaseOsCode == "" {
+	switch self.config.ImageNameConflict {
+	case IMAGE_NAME_CONFLICT_ERROR, IMAGE_NAME_CONFLICT_REPLACE, IMAGE_NAME_CONFLICT_SUFFIX:
+	default:
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Unknown image_name_conflict '%s'. Must be one of 'error' (the default), 'replace' or 'suffix'.", self.config.ImageNameConflict))
+	}
+
+	// Exactly one base image must be chosen
+	var baseImageOptions []string
+	if self.config.BaseImageId != "" {
+		baseImageOptions = append(baseImageOptions, "base_image_id")
+	}
+	if self.config.BaseOsCode != "" {
+		baseImageOptions = append(baseImageOptions, "base_os_code")
+	}
+	if self.config.BaseImageSource.IsSet() {
+		baseImageOptions = append(baseImageOptions, "base_image_source")
+		errs = packer.MultiErrorAppend(errs, self.config.BaseImageSource.Prepare()...)
+	}
+	if self.config.BaseImageFilter.IsSet() {
+		baseImageOptions = append(baseImageOptions, "base_image_filter")
+		errs = packer.MultiErrorAppend(errs, self.config.BaseImageFilter.Prepare()...)
+	}
+
+	if len(baseImageOptions) == 0 {
+		errs = packer.MultiErrorAppend(
+			errs, errors.New("please specify base_image_id, base_image_filter, base_image_source or base_os_code"))
+	}
+
+	if len(baseImageOptions) > 1 {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("please specify only one of base_image_id, base_image_filter, base_image_source or base_os_code (got %s)",
+				strings.Join(baseImageOptions, ", ")))
+	}
+
+	if len(baseImageOptions) > 0 && self.config.BaseOsCode == "" && self.config.Comm.Type == "ssh" &&
+		self.config.Comm.SSHPrivateKey == "" && !self.config.SSHUseProvisionedPassword && !self.config.SSHAgentAuth {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("when using %s, you must specify ssh_private_key_file, ssh_agent_auth or ssh_use_provisioned_password "+
+				"since automatic ssh key config for custom images isn't supported by SoftLayer API", baseImageOptions[0]))
+	}
+
+	if err := validateTemporaryKey(self.config.TemporaryKeyType, self.config.TemporaryKeyBits); err != nil {
+		errs = packer.MultiErrorAppend(errs, err)
+	}
+
+	if len(self.config.SSHKeyIds) > 0 || len(self.config.SSHKeyLabels) > 0 {
+		if self.config.Comm.Type != "ssh" || self.config.Comm.SSHPrivateKey == "" {
+			errs = packer.MultiErrorAppend(
+				errs, errors.New("ssh_key_ids and ssh_key_labels require the ssh communicator and ssh_private_key_file"))
+		}
+
+		for _, keyId := range self.config.SSHKeyIds {
+			if keyId <= 0 {
+				errs = packer.MultiErrorAppend(
+					errs, fmt.Errorf("Invalid ssh_key_ids entry '%d'. Key ids must be positive numbers.", keyId))
+			}
+		}
+	}
+
+	switch self.config.OnError {
+	case "", ON_ERROR_DESTROY, ON_ERROR_KEEP, ON_ERROR_ASK:
+	default:
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Unknown on_error '%s'. Must be one of 'destroy' (the default), 'keep' or 'ask'.", self.config.OnError))
+	}
+
+	if self.config.SSHBastionLookup.IsSet() {
+		errs = packer.MultiErrorAppend(errs, self.config.SSHBastionLookup.Prepare()...)
+
+		if self.config.Comm.SSHBastionHost != "" {
+			errs = packer.MultiErrorAppend(
+				errs, errors.New("please specify only one of ssh_bastion_host or ssh_bastion_lookup"))
+		}
+
+		// The communicator only defaults and checks the bastion options when ssh_bastion_host is set,
+		// the looked up bastion is only known at build time
+		if self.config.Comm.SSHBastionPort == 0 {
+			self.config.Comm.SSHBastionPort = 22
+		}
+
+		if self.config.Comm.SSHBastionPrivateKey == "" && self.config.Comm.SSHPrivateKey != "" {
+			self.config.Comm.SSHBastionPrivateKey = self.config.Comm.SSHPrivateKey
+		}
+
+		if self.config.Comm.SSHBastionPassword == "" && self.config.Comm.SSHBastionPrivateKey == "" {
+			errs = packer.MultiErrorAppend(
+				errs, errors.New("ssh_bastion_password or ssh_bastion_private_key_file must be specified with ssh_bastion_lookup"))
+		}
+	}
+
+	if (self.config.SSHBastionLookup.IsSet() || self.config.Comm.SSHBastionHost != "") && self.config.Comm.Type != "ssh" {
 		errs = packer.MultiErrorAppend(
-			errs, errors.New("please specify base_image_id or base_os_code"))
+			errs, errors.New("ssh_bastion_host and ssh_bastion_lookup can only be used with the ssh communicator"))
 	}
 
-	if self.config.BaseImageId != "" && self.config.BaseOsCode != "" {
+	if self.config.SSHHostKeyFingerprint != "" && !isValidFingerprint(self.config.SSHHostKeyFingerprint) {
 		errs = packer.MultiErrorAppend(
-			errs, errors.New("please specify only one of base_image_id or base_os_code"))
+			errs, fmt.Errorf("Invalid ssh_host_key_fingerprint '%s'. It must be a SHA256 (\"SHA256:...\") or MD5 (\"aa:bb:...\") fingerprint.",
+				self.config.SSHHostKeyFingerprint))
 	}
 
-	if self.config.BaseImageId != "" && self.config.Comm.SSHPrivateKey == "" {
+	if self.config.SSHCertificateFile != "" && self.config.Comm.SSHPrivateKey == "" {
 		errs = packer.MultiErrorAppend(
-			errs, errors.New("when using base_image_id, you must specify ssh_private_key_file "+
-				"since automatic ssh key config for custom images isn't supported by SoftLayer API"))
+			errs, errors.New("ssh_certificate_file requires the ssh_private_key_file the certificate was issued for"))
+	}
+
+	if self.config.SSHPrivateKeyPassphrase != "" && self.config.Comm.SSHPrivateKey == "" {
+		errs = packer.MultiErrorAppend(
+			errs, errors.New("ssh_private_key_passphrase requires ssh_private_key_file"))
+	}
+
+	if self.config.SSHUseProvisionedPassword && self.config.Comm.Type != "ssh" {
+		errs = packer.MultiErrorAppend(
+			errs, errors.New("ssh_use_provisioned_password can only be used with the ssh communicator"))
+	}
+
+	if !isValidHostname(self.config.InstanceName) {
+		if instanceNameSuffix != "" {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Invalid instance_name_prefix '%s'. It may only contain letters, digits and hyphens, "+
+					"must start with a letter or a digit and be at most %d characters long.",
+					self.config.InstanceNamePrefix, maxHostnameLength-len(instanceNameSuffix)))
+		} else {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Invalid instance_name '%s'. It may only contain letters, digits and hyphens, "+
+					"must start and end with a letter or a digit and be at most %d characters long.",
+					self.config.InstanceName, maxHostnameLength))
+		}
+	}
+
+	if !isValidDomain(self.config.InstanceDomain) {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Invalid instance_domain '%s'. It must be made of dot separated labels of letters, digits and hyphens, "+
+				"and be at most %d characters long.", self.config.InstanceDomain, maxDomainLength))
+	} else if len(self.config.InstanceName)+1+len(self.config.InstanceDomain) > maxDomainLength {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("The fully qualified instance name '%s.%s' must be at most %d characters long.",
+				self.config.InstanceName, self.config.InstanceDomain, maxDomainLength))
+	}
+
+	if self.config.Export.IsSet() {
+		if self.config.Export.ObjectName == "" {
+			self.config.Export.ObjectName = fmt.Sprintf("%s.vhd", self.config.ImageName)
+		}
+		errs = packer.MultiErrorAppend(errs, self.config.Export.Prepare("export")...)
+	}
+
+	if self.config.ImageRetention.IsSet() {
+		errs = packer.MultiErrorAppend(errs, self.config.ImageRetention.Prepare()...)
+	}
+
+	for _, accountId := range self.config.ImageShareAccounts {
+		if accountId <= 0 {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Invalid image_share_accounts entry '%d'. Account ids must be positive numbers.", accountId))
+		}
+	}
+
+	for _, tag := range self.config.InstanceTags {
+		if err := validateTag(tag); err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Invalid instance_tags entry: %s", err))
+		}
+	}
+
+	for _, tag := range self.config.ImageTags {
+		if err := validateTag(tag); err != nil {
+			errs = packer.MultiErrorAppend(
+				errs, fmt.Errorf("Invalid image_tags entry: %s", err))
+		}
 	}
 
 	stateTimeout, err := time.ParseDuration(self.config.RawStateTimeout)
@@ -167,7 +414,18 @@ func (self *Builder) Prepare(raws ...interface{}) (parms []string, retErr error)
 	}
 	self.config.StateTimeout = stateTimeout
 
-	log.Println(common.ScrubConfig(self.config, self.config.APIKey, self.config.Username))
+	resourceTTL, err := time.ParseDuration(self.config.RawResourceTTL)
+	if err != nil {
+		errs = packer.MultiErrorAppend(
+			errs, fmt.Errorf("Failed parsing resource_ttl: %s", err))
+	} else if resourceTTL <= 0 {
+		errs = packer.MultiErrorAppend(
+			errs, errors.New("resource_ttl must be a positive duration"))
+	}
+	self.config.ResourceTTL = resourceTTL
+
+	log.Println(common.ScrubConfig(self.config, self.config.APIKey, self.config.Username, self.config.Export.IBMApiKey, self.config.BaseImageSource.IBMApiKey,
+		self.config.SSHPrivateKeyPassphrase))
 
 	if len(errs.Errors) > 0 {
 		retErr = errors.New(errs.Error())
@@ -189,21 +447,47 @@ func (self *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (pa
 	state.Put("client", client)
 	state.Put("hook", hook)
 	state.Put("ui", ui)
+	state.Put("build_id", uuid.TimeOrderedUUID())
+	state.Put("build_expires_at", time.Now().Add(self.config.ResourceTTL))
 
 	// Build the steps
-	steps := []multistep.Step{
-		&stepCreateSshKey{
-			PrivateKeyFile: self.config.Comm.SSHPrivateKey,
-		},
-		new(stepCreateInstance),
-		new(stepWaitforInstance),
-		&communicator.StepConnect{
-			Config:    &self.config.Comm,
-			Host:      commHost,
-			SSHConfig: sshConfig,
-		},
-		new(common.StepProvision),
-		new(stepCaptureImage),
+	var steps []multistep.Step
+	if self.config.DryRun {
+		steps = []multistep.Step{
+			new(stepResolveBaseImage),
+			new(stepPreflight),
+			new(stepDryRun),
+		}
+	} else {
+		steps = []multistep.Step{
+			new(stepResolveBaseImage),
+			new(stepPreflight),
+			&stepResolveBastion{
+				Comm: &self.config.Comm,
+			},
+			new(stepImportBaseImage),
+			&stepCreateSshKey{
+				PrivateKeyFile: self.config.Comm.SSHPrivateKey,
+			},
+			new(stepCreateInstance),
+			new(stepWaitforInstance),
+			new(stepGetPassword),
+			new(stepConnectSshAgent),
+			&communicator.StepConnect{
+				Config:      &self.config.Comm,
+				Host:        commHost,
+				SSHConfig:   sshConfig,
+				WinRMConfig: winrmConfig,
+			},
+			new(common.StepProvision),
+			new(stepCaptureImage),
+			new(stepCopyImage),
+			new(stepShareImage),
+			new(stepExportImage),
+			new(stepReplaceImages),
+			new(stepPruneImages),
+			new(stepFinalizeImage),
+		}
 	}
 
 	// Create the runner which will run the steps we just build
@@ -215,6 +499,11 @@ func (self *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (pa
 		return nil, rawErr.(error)
 	}
 
+	// A dry run never creates an image
+	if self.config.DryRun {
+		return nil, nil
+	}
+
 	if _, ok := state.GetOk("image_id"); !ok {
 		log.Println("Failed to find image_id in state. Bug?")
 		return nil, nil
@@ -222,15 +511,83 @@ func (self *Builder) Run(ui packer.Ui, hook packer.Hook, cache packer.Cache) (pa
 
 	// Create an artifact and return it
 	artifact := &Artifact{
-		imageName:      self.config.ImageName,
-		imageId:        state.Get("image_id").(string),
-		datacenterName: self.config.DatacenterName,
-		client:         client,
+		imageName:       state.Get("image_name").(string),
+		imageId:         state.Get("image_id").(string),
+		templateGroupId: state.Get("image_template_group_id").(int64),
+		sourceImageId:   self.config.BaseImageId,
+		sourceOsCode:    self.config.BaseOsCode,
+		imageTags:       self.config.ImageTags,
+		datacenters:     state.Get("image_datacenters").([]string),
+		stateTimeout:    self.config.StateTimeout,
+		client:          client,
+	}
+
+	// An imported base image is described by its source instead, it may be deleted after the build
+	if self.config.BaseImageSource.IsSet() {
+		artifact.sourceOsCode = self.config.BaseImageSource.OsCode
+	} else if baseImageId, ok := state.GetOk("base_image_id"); ok {
+		artifact.sourceImageId = baseImageId.(string)
+	}
+
+	if instanceData, ok := state.GetOk("instance_data"); ok {
+		artifact.instanceId = instanceData.(map[string]interface{})["globalIdentifier"].(string)
+	}
+
+	if exportUri, ok := state.GetOk("image_export_uri"); ok {
+		artifact.files = []string{exportUri.(string)}
+	}
+
+	if sharedAccounts, ok := state.GetOk("image_shared_accounts"); ok {
+		artifact.sharedAccounts = sharedAccounts.([]int)
+	}
+
+	if cost, ok := reportBuildCost(state); ok {
+		artifact.cost = cost
 	}
 
 	return artifact, nil
 }
 
+// Limits on instance host and domain names, as defined by RFC 1123
+const maxHostnameLength = 63
+const maxDomainLength = 253
+
+var hostnameLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?$`)
+
+// isValidHostname checks that the name is a single RFC 1123 host name label.
+func isValidHostname(name string) bool {
+	return len(name) <= maxHostnameLength && hostnameLabel.MatchString(name)
+}
+
+// isValidDomain checks that the domain is made of valid RFC 1123 labels.
+func isValidDomain(domain string) bool {
+	if domain == "" || len(domain) > maxDomainLength {
+		return false
+	}
+
+	for _, label := range strings.Split(domain, ".") {
+		if !isValidHostname(label) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateTag makes sure a tag can be sent to SoftLayer's setTags call, which
+// takes all of the tags as a single comma separated string.
+func validateTag(tag string) error {
+	if strings.TrimSpace(tag) == "" {
+		return errors.New("tags must not be empty")
+	}
+
+	if strings.Contains(tag, ",") {
+		return fmt.Errorf("tag '%s' must not contain a comma", tag)
+	}
+
+	return nil
+}
+
 // Cancel.
 func (self *Builder) Cancel() {
 	if self.runner != nil {
@@ -1,7 +1,9 @@
 package softlayer
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func testConfig() map[string]interface{} {
@@ -43,3 +45,530 @@ func TestPrepare_ImageType(t *testing.T) {
 		t.Fatal("Expected an error")
 	}
 }
+
+func TestPrepare_Tags(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	c["instance_tags"] = []string{"packer", "team:build"}
+	c["image_tags"] = []string{"golden", "os:centos"}
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(b.config.InstanceTags) != 2 || b.config.InstanceTags[1] != "team:build" {
+		t.Fatalf("Unexpected instance_tags: %v", b.config.InstanceTags)
+	}
+
+	if len(b.config.ImageTags) != 2 || b.config.ImageTags[1] != "os:centos" {
+		t.Fatalf("Unexpected image_tags: %v", b.config.ImageTags)
+	}
+
+	// Tags are sent as a comma separated list, so commas are not allowed
+	c["image_tags"] = []string{"a,b"}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	c["image_tags"] = []string{"golden"}
+	c["instance_tags"] = []string{" "}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestPrepare_InstanceName(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+
+	// Default instance_name
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !strings.HasPrefix(b.config.InstanceName, "packer-softlayer-") || !isValidHostname(b.config.InstanceName) {
+		t.Fatalf("Expected a valid generated instance_name but got '%s'", b.config.InstanceName)
+	}
+
+	firstName := b.config.InstanceName
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.InstanceName == firstName {
+		t.Fatalf("Expected unique generated instance names but got '%s' twice", firstName)
+	}
+
+	// Custom prefix
+	c["instance_name_prefix"] = "golden"
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !strings.HasPrefix(b.config.InstanceName, "golden-") {
+		t.Fatalf("Expected instance_name to start with 'golden-' but got '%s'", b.config.InstanceName)
+	}
+
+	c["instance_name_prefix"] = "golden_image"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	c["instance_name_prefix"] = strings.Repeat("a", 30)
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	// User supplied names are validated, not rewritten
+	delete(c, "instance_name_prefix")
+	for _, name := range []string{"packer-centos-2015-06-01T10:00:00Z", "-packer", "packer-", strings.Repeat("a", 64)} {
+		c["instance_name"] = name
+		if _, err := b.Prepare(c); err == nil {
+			t.Fatalf("Expected an error for instance_name '%s'", name)
+		}
+	}
+
+	c["instance_name"] = "packer-centos-1433152800"
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.InstanceName != "packer-centos-1433152800" {
+		t.Fatalf("Expected instance_name to be kept but got '%s'", b.config.InstanceName)
+	}
+}
+
+func TestPrepare_InstanceDomain(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	for _, domain := range []string{"example.com", "build.example-corp.com", "localdomain"} {
+		c["instance_domain"] = domain
+		if _, err := b.Prepare(c); err != nil {
+			t.Fatalf("Unexpected error for instance_domain '%s': %s", domain, err)
+		}
+	}
+
+	for _, domain := range []string{"example..com", ".example.com", "example.com.", "exa_mple.com", "-example.com"} {
+		c["instance_domain"] = domain
+		if _, err := b.Prepare(c); err == nil {
+			t.Fatalf("Expected an error for instance_domain '%s'", domain)
+		}
+	}
+}
+
+func TestPrepare_ImageShareAccounts(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	c["image_share_accounts"] = []int{123456, 654321}
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(b.config.ImageShareAccounts) != 2 || b.config.ImageShareAccounts[1] != 654321 {
+		t.Fatalf("Unexpected image_share_accounts: %v", b.config.ImageShareAccounts)
+	}
+
+	c["image_share_accounts"] = []int{0}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestPrepare_Export(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	c["export"] = map[string]interface{}{
+		"bucket":      "images",
+		"endpoint":    "us-south",
+		"ibm_api_key": "secret",
+	}
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.Export.Type != OBJECT_STORAGE_ICOS {
+		t.Fatalf("Expected default export type 'icos' but got '%s'", b.config.Export.Type)
+	}
+
+	if uri := b.config.Export.Uri(); uri != "cos://us-south/images/testimage.vhd" {
+		t.Fatalf("Unexpected export uri '%s'", uri)
+	}
+
+	// Swift needs the object storage account instead of an api key
+	c["export"] = map[string]interface{}{
+		"type":          "swift",
+		"bucket":        "images",
+		"endpoint":      "dal05",
+		"object_name":   "golden.vhd",
+		"swift_account": "SLOS123-1",
+	}
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if uri := b.config.Export.Uri(); uri != "swift://SLOS123-1@dal05/images/golden.vhd" {
+		t.Fatalf("Unexpected export uri '%s'", uri)
+	}
+
+	c["export"] = map[string]interface{}{
+		"type":     "swift",
+		"bucket":   "images",
+		"endpoint": "dal05",
+	}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	c["export"] = map[string]interface{}{
+		"type":        "s3",
+		"bucket":      "images",
+		"endpoint":    "us-south",
+		"ibm_api_key": "secret",
+	}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	c["export"] = map[string]interface{}{
+		"ibm_api_key": "secret",
+	}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestPrepare_BaseImageSource(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	delete(c, "base_os_code")
+	c["ssh_private_key_file"] = "/path/to/key"
+	c["base_image_source"] = map[string]interface{}{
+		"endpoint":           "us-south",
+		"bucket":             "images",
+		"object_name":        "centos.vhd",
+		"ibm_api_key":        "secret",
+		"os_code":            "CENTOS_7_64",
+		"delete_after_build": true,
+	}
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !b.config.BaseImageSource.DeleteAfterBuild || b.config.BaseImageSource.Uri() != "cos://us-south/images/centos.vhd" {
+		t.Fatalf("Unexpected base_image_source: %#v", b.config.BaseImageSource)
+	}
+
+	// The imported image is a custom image, so a private key is required
+	delete(c, "ssh_private_key_file")
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	// Only one base image can be used
+	c["ssh_private_key_file"] = "/path/to/key"
+	c["base_os_code"] = "CENTOS_7_64"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	// The OS of the imported image must be known
+	delete(c, "base_os_code")
+	delete(c["base_image_source"].(map[string]interface{}), "os_code")
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestPrepare_BaseImageFilter(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	delete(c, "base_os_code")
+	c["ssh_private_key_file"] = "/path/to/key"
+	c["base_image_filter"] = map[string]interface{}{
+		"name":        "^golden-centos-",
+		"tags":        []string{"golden"},
+		"most_recent": true,
+	}
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !b.config.BaseImageFilter.MostRecent || b.config.BaseImageFilter.Tags[0] != "golden" {
+		t.Fatalf("Unexpected base_image_filter: %#v", b.config.BaseImageFilter)
+	}
+
+	c["base_image_filter"] = map[string]interface{}{
+		"name": "golden-(",
+	}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	// most_recent alone doesn't select anything
+	c["base_image_filter"] = map[string]interface{}{
+		"most_recent": true,
+	}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	c["base_image_filter"] = map[string]interface{}{
+		"name": "golden",
+	}
+	c["base_image_id"] = "some-image"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestPrepare_ImageNameConflict(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.ImageNameConflict != IMAGE_NAME_CONFLICT_ERROR {
+		t.Fatalf("Expected default image_name_conflict 'error' but got '%s'", b.config.ImageNameConflict)
+	}
+
+	for _, value := range []string{IMAGE_NAME_CONFLICT_REPLACE, IMAGE_NAME_CONFLICT_SUFFIX} {
+		c["image_name_conflict"] = value
+		if _, err := b.Prepare(c); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	c["image_name_conflict"] = "overwrite"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestPrepare_ImageRetention(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	c["image_retention"] = map[string]interface{}{
+		"keep_last": 5,
+		"max_age":   "720h",
+		"tag":       "nightly",
+	}
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c["image_retention"] = map[string]interface{}{"keep_last": 5}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for a policy matching no images")
+	}
+
+	c["image_retention"] = map[string]interface{}{"name_prefix": "centos-"}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for a policy without limits")
+	}
+
+	c["image_retention"] = map[string]interface{}{"max_age": "a month", "name_prefix": "centos-"}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for an invalid max_age")
+	}
+}
+
+func TestPrepare_WinRM(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.Comm.SSHUsername != "root" {
+		t.Fatalf("Expected default ssh_username 'root' but got '%s'", b.config.Comm.SSHUsername)
+	}
+
+	b = Builder{}
+	c["communicator"] = "winrm"
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.Comm.WinRMUser != "Administrator" {
+		t.Fatalf("Expected default winrm_username 'Administrator' but got '%s'", b.config.Comm.WinRMUser)
+	}
+
+	// The password is fetched from SoftLayer, so images don't need a private key
+	delete(c, "base_os_code")
+	c["base_image_id"] = "some-image"
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
+
+func TestPrepare_SSHUseProvisionedPassword(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	delete(c, "base_os_code")
+	c["base_image_id"] = "some-image"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for an image without a private key")
+	}
+
+	c["ssh_use_provisioned_password"] = true
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c["communicator"] = "winrm"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for the winrm communicator")
+	}
+}
+
+func TestPrepare_TemporaryKey(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.TemporaryKeyType != TEMPORARY_KEY_TYPE_RSA || b.config.TemporaryKeyBits != 2048 {
+		t.Fatalf("Expected a default 2048 bits rsa key but got %d bits %s", b.config.TemporaryKeyBits, b.config.TemporaryKeyType)
+	}
+
+	b = Builder{}
+	c["temporary_key_type"] = "ecdsa"
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.TemporaryKeyBits != 256 {
+		t.Fatalf("Expected a default 256 bits ecdsa key but got %d bits", b.config.TemporaryKeyBits)
+	}
+
+	c["temporary_key_type"] = "dsa"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for an unsupported key type")
+	}
+}
+
+func TestPrepare_SSHKeys(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	c["ssh_key_labels"] = []string{"provisioning"}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error without ssh_private_key_file")
+	}
+
+	c["ssh_private_key_file"] = "id_rsa"
+	c["ssh_key_ids"] = []int64{1234}
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c["ssh_key_ids"] = []int64{-1}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for an invalid key id")
+	}
+}
+
+func TestPrepare_Bastion(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	c["instance_private_network_only"] = true
+	c["ssh_bastion_lookup"] = map[string]interface{}{"tag": "bastion"}
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for a lookup without bastion credentials")
+	}
+
+	c["ssh_private_key_file"] = "/path/to/key"
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// The looked up bastion gets the defaults of ssh_bastion_host
+	if b.config.Comm.SSHBastionPort != 22 {
+		t.Fatalf("Expected the bastion port to default to 22, got %d", b.config.Comm.SSHBastionPort)
+	}
+
+	if b.config.Comm.SSHBastionPrivateKey != "/path/to/key" {
+		t.Fatalf("Expected the bastion key to default to ssh_private_key_file, got '%s'", b.config.Comm.SSHBastionPrivateKey)
+	}
+
+	c["ssh_bastion_port"] = 2222
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.Comm.SSHBastionPort != 2222 {
+		t.Fatalf("Expected the bastion port 2222, got %d", b.config.Comm.SSHBastionPort)
+	}
+
+	c["ssh_bastion_host"] = "jump.example.com"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for both ssh_bastion_host and ssh_bastion_lookup")
+	}
+
+	delete(c, "ssh_bastion_lookup")
+	c["communicator"] = "winrm"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for a bastion with the winrm communicator")
+	}
+
+	c["communicator"] = "ssh"
+	c["ssh_bastion_lookup"] = map[string]interface{}{"use_private_ip": true}
+	delete(c, "ssh_bastion_host")
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for a lookup without hostname or tag")
+	}
+}
+
+func TestPrepare_OnError(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	for _, value := range []string{ON_ERROR_DESTROY, ON_ERROR_KEEP, ON_ERROR_ASK} {
+		c["on_error"] = value
+		if _, err := b.Prepare(c); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	c["on_error"] = "abort"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestPrepare_ResourceTTL(t *testing.T) {
+	var b Builder
+
+	c := testConfig()
+	if _, err := b.Prepare(c); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if b.config.ResourceTTL != 24*time.Hour {
+		t.Fatalf("Expected a default resource_ttl of 24h but got %s", b.config.ResourceTTL)
+	}
+
+	c["resource_ttl"] = "-1h"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for a negative resource_ttl")
+	}
+
+	c["resource_ttl"] = "a day"
+	if _, err := b.Prepare(c); err == nil {
+		t.Fatal("Expected an error for an invalid resource_ttl")
+	}
+}
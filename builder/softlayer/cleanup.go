@@ -0,0 +1,192 @@
+package softlayer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// expiredResource is a resource left behind by a build once its build tags expired.
+type expiredResource struct {
+	kind      string
+	id        string
+	name      string
+	buildId   string
+	expiresAt time.Time
+	delete    func() error
+}
+
+// CleanupOptions configures CleanupExpiredResources.
+type CleanupOptions struct {
+	// Only list the expired resources
+	DryRun bool
+
+	// A build that died before tagging its instance leaves an untagged instance behind. The untagged
+	// instances named "<InstanceNamePrefix>-..." are deleted once they are older than UntaggedTTL.
+	InstanceNamePrefix string
+	UntaggedTTL        time.Duration
+}
+
+// CleanupExpiredResources deletes the instances, ssh keys and images left behind by builds that
+// couldn't clean up after themselves, e.g. because packer was killed, once their resource_ttl expired.
+// The progress is written to out.
+func CleanupExpiredResources(username string, apiKey string, options CleanupOptions, out io.Writer) error {
+	client := SoftlayerClient{}.New(username, apiKey)
+
+	resources, err := findExpiredResources(client, options, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if len(resources) == 0 {
+		fmt.Fprintln(out, "No expired build resources")
+		return nil
+	}
+
+	failures := 0
+	for _, resource := range resources {
+		buildId := resource.buildId
+		if buildId == "" {
+			buildId = "unknown (untagged)"
+		}
+
+		description := fmt.Sprintf("%s %s (%s) of build %s, expired at %s",
+			resource.kind, resource.id, resource.name, buildId, resource.expiresAt.Format(time.RFC3339))
+
+		if options.DryRun {
+			fmt.Fprintf(out, "Would delete %s\n", description)
+			continue
+		}
+
+		if err := resource.delete(); err != nil {
+			fmt.Fprintf(out, "Error deleting %s: %s\n", description, err)
+			failures++
+			continue
+		}
+
+		fmt.Fprintf(out, "Deleted %s\n", description)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("Failed to delete %d of %d expired build resources", failures, len(resources))
+	}
+
+	return nil
+}
+
+// findExpiredResources lists the resources of the account whose build tags expired before now.
+func findExpiredResources(client *SoftlayerClient, options CleanupOptions, now time.Time) ([]expiredResource, error) {
+	var resources []expiredResource
+
+	guests, err := client.getVirtualGuests()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing the instances of the account: %s", err)
+	}
+
+	expiredGuests := expiredResources(guests, now, tagNames)
+	expiredGuests = append(expiredGuests, expiredUntaggedInstances(guests, options.InstanceNamePrefix, options.UntaggedTTL, now)...)
+	for _, guest := range expiredGuests {
+		instanceId := guest.resource["globalIdentifier"].(string)
+		resources = append(resources, expiredResource{
+			kind: "instance", id: instanceId, name: fmt.Sprintf("%v", guest.resource["fullyQualifiedDomainName"]),
+			buildId: guest.buildId, expiresAt: guest.expiresAt,
+			delete: func() error { return client.DestroyInstance(instanceId) },
+		})
+	}
+
+	keys, err := client.getSshKeys()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing the ssh keys of the account: %s", err)
+	}
+
+	for _, key := range expiredResources(keys, now, sshKeyNoteTags) {
+		keyId := int64(key.resource["id"].(float64))
+		resources = append(resources, expiredResource{
+			kind: "ssh key", id: fmt.Sprintf("%d", keyId), name: fmt.Sprintf("%v", key.resource["label"]),
+			buildId: key.buildId, expiresAt: key.expiresAt,
+			delete: func() error { return client.DestroySshKey(keyId) },
+		})
+	}
+
+	images, err := client.getBlockDeviceTemplateGroups()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing the images of the account: %s", err)
+	}
+
+	for _, image := range expiredResources(images, now, tagNames) {
+		templateGroupId := int64(image.resource["id"].(float64))
+		resources = append(resources, expiredResource{
+			kind: "image", id: fmt.Sprintf("%v", image.resource["globalIdentifier"]), name: fmt.Sprintf("%v", image.resource["name"]),
+			buildId: image.buildId, expiresAt: image.expiresAt,
+			delete: func() error { return client.deleteImage(templateGroupId) },
+		})
+	}
+
+	return resources, nil
+}
+
+// taggedResource is a resource of the account marked by a build.
+type taggedResource struct {
+	resource  map[string]interface{}
+	buildId   string
+	expiresAt time.Time
+}
+
+// expiredResources returns the resources, out of a list of SoftLayer objects, whose build tags expired before now.
+func expiredResources(objects []interface{}, now time.Time, tags func(map[string]interface{}) []string) []taggedResource {
+	var expired []taggedResource
+	for _, val := range objects {
+		resource, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		buildId, expiresAt, ok := buildExpiry(tags(resource))
+		if ok && expiresAt.Before(now) {
+			expired = append(expired, taggedResource{resource, buildId, expiresAt})
+		}
+	}
+
+	return expired
+}
+
+// expiredUntaggedInstances returns the instances, out of a list of guests, without tags, named after the
+// instance name prefix and created more than ttl before now. A build that died between ordering its instance
+// and tagging it leaves such an instance behind.
+func expiredUntaggedInstances(guests []interface{}, prefix string, ttl time.Duration, now time.Time) []taggedResource {
+	var expired []taggedResource
+	if prefix == "" || ttl <= 0 {
+		return expired
+	}
+
+	for _, val := range guests {
+		guest, ok := val.(map[string]interface{})
+		if !ok || len(tagNames(guest)) > 0 {
+			continue
+		}
+
+		hostname, _ := guest["hostname"].(string)
+		if !strings.HasPrefix(hostname, prefix+"-") {
+			continue
+		}
+
+		// Guests have the same createDate format as images, an unknown age never expires
+		createdAt := imageCreateDate(guest)
+		if createdAt.IsZero() {
+			continue
+		}
+
+		if expiresAt := createdAt.Add(ttl); expiresAt.Before(now) {
+			expired = append(expired, taggedResource{guest, "", expiresAt})
+		}
+	}
+
+	return expired
+}
+
+// sshKeyNoteTags returns the build tags stored in the notes of an ssh key.
+func sshKeyNoteTags(key map[string]interface{}) []string {
+	notes, _ := key["notes"].(string)
+	return strings.Fields(notes)
+}
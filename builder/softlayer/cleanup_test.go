@@ -0,0 +1,86 @@
+package softlayer
+
+import (
+	"github.com/mitchellh/multistep"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCleanup_BuildTags(t *testing.T) {
+	expiresAt := time.Unix(1500000000, 0)
+
+	state := new(multistep.BasicStateBag)
+	state.Put("build_id", "0b4b3c3e-0c1b-4d8a-9f4e-5c7a8d6e2f10")
+	state.Put("build_expires_at", expiresAt)
+
+	tags := append([]string{"nightly"}, buildTags(state)...)
+	buildId, parsedExpiresAt, ok := buildExpiry(tags)
+	if !ok || buildId != "0b4b3c3e-0c1b-4d8a-9f4e-5c7a8d6e2f10" || !parsedExpiresAt.Equal(expiresAt) {
+		t.Fatalf("Unexpected build tags %v: '%s', %s, %v", tags, buildId, parsedExpiresAt, ok)
+	}
+
+	if _, _, ok := buildExpiry([]string{"nightly", BUILD_ID_TAG_PREFIX + "some-build"}); ok {
+		t.Fatal("Expected resources without an expiry not to be marked")
+	}
+
+	if _, _, ok := buildExpiry([]string{BUILD_EXPIRES_TAG_PREFIX + "1500000000"}); ok {
+		t.Fatal("Expected resources without a build id not to be marked")
+	}
+}
+
+func TestCleanup_ExpiredResources(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tags := func(buildId string, expiresAt int64) []interface{} {
+		return []interface{}{
+			map[string]interface{}{"tag": map[string]interface{}{"name": BUILD_ID_TAG_PREFIX + buildId}},
+			map[string]interface{}{"tag": map[string]interface{}{"name": BUILD_EXPIRES_TAG_PREFIX + strconv.FormatInt(expiresAt, 10)}},
+		}
+	}
+
+	guests := []interface{}{
+		map[string]interface{}{"id": 1., "tagReferences": tags("expired", 1499999999)},
+		map[string]interface{}{"id": 2., "tagReferences": tags("running", 1500003600)},
+		map[string]interface{}{"id": 3.},
+	}
+
+	expired := expiredResources(guests, now, tagNames)
+	if len(expired) != 1 || expired[0].resource["id"] != 1. || expired[0].buildId != "expired" {
+		t.Fatalf("Expected only the first instance to be expired but got: %v", expired)
+	}
+
+	keys := []interface{}{
+		map[string]interface{}{"id": 1., "notes": BUILD_ID_TAG_PREFIX + "expired " + BUILD_EXPIRES_TAG_PREFIX + "1499999999"},
+		map[string]interface{}{"id": 2., "notes": "the provisioning key of the security team"},
+	}
+
+	expired = expiredResources(keys, now, sshKeyNoteTags)
+	if len(expired) != 1 || expired[0].resource["id"] != 1. {
+		t.Fatalf("Expected only the first key to be expired but got: %v", expired)
+	}
+}
+
+func TestCleanup_ExpiredUntaggedInstances(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-01-05T00:00:00-06:00")
+	tagged := []interface{}{
+		map[string]interface{}{"tag": map[string]interface{}{"name": "web"}},
+	}
+
+	guests := []interface{}{
+		map[string]interface{}{"id": 1., "hostname": "packer-softlayer-1", "createDate": "2016-01-03T00:00:00-06:00"},
+		map[string]interface{}{"id": 2., "hostname": "packer-softlayer-2", "createDate": "2016-01-04T12:00:00-06:00"},
+		map[string]interface{}{"id": 3., "hostname": "packer-softlayer-3", "createDate": "2016-01-03T00:00:00-06:00", "tagReferences": tagged},
+		map[string]interface{}{"id": 4., "hostname": "web-1", "createDate": "2016-01-03T00:00:00-06:00"},
+		map[string]interface{}{"id": 5., "hostname": "packer-softlayer-5"},
+	}
+
+	// Only the untagged instance named after the prefix and older than the ttl expired
+	expired := expiredUntaggedInstances(guests, DEFAULT_INSTANCE_NAME_PREFIX, 24*time.Hour, now)
+	if len(expired) != 1 || expired[0].resource["id"] != 1. || expired[0].buildId != "" {
+		t.Fatalf("Expected only the first instance to be expired but got: %v", expired)
+	}
+
+	if expired := expiredUntaggedInstances(guests, "", 24*time.Hour, now); len(expired) != 0 {
+		t.Fatalf("Expected no instance to be expired without a prefix but got: %v", expired)
+	}
+}
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -42,6 +45,12 @@ type InstanceType struct {
 	ProvisioningSshKeyId int64
 	BaseImageId          string
 	BaseOsCode           string
+
+	// Keys of the account attached to the instance in addition to the provisioning key
+	SshKeyIds []int64
+
+	// Order the instance without a public network interface
+	PrivateNetworkOnly bool
 }
 
 type InstanceReq struct {
@@ -57,6 +66,7 @@ type InstanceReq struct {
 	BlockDevices             []*BlockDevice            `json:"blockDevices,omitempty"`
 	OsReferenceCode          string                    `json:"operatingSystemReferenceCode,omitempty"`
 	SshKeys                  []*SshKey                 `json:"sshKeys,omitempty"`
+	PrivateNetworkOnlyFlag   bool                      `json:"privateNetworkOnlyFlag,omitempty"`
 }
 
 type InstanceImage struct {
@@ -69,6 +79,19 @@ type Datacenter struct {
 	Name string `json:"name"`
 }
 
+type Location struct {
+	Id int64 `json:"id"`
+}
+
+// Based on: http://sldn.softlayer.com/reference/datatypes/SoftLayer_Container_Virtual_Guest_Block_Device_Template_Configuration/
+type ImageTransferConfiguration struct {
+	Name            string `json:"name,omitempty"`
+	Note            string `json:"note,omitempty"`
+	Uri             string `json:"uri"`
+	IbmApiKey       string `json:"ibmApiKey,omitempty"`
+	OsReferenceCode string `json:"operatingSystemReferenceCode,omitempty"`
+}
+
 type NetworkComponent struct {
 	MaxSpeed int `json:"maxSpeed"`
 }
@@ -85,6 +108,7 @@ type SshKey struct {
 	Id    int64  `json:"id,omitempty"`
 	Key   string `json:"key,omitempty"`
 	Label string `json:"label,omitempty"`
+	Notes string `json:"notes,omitempty"`
 }
 
 type BlockDevice struct {
@@ -120,15 +144,58 @@ func (self SoftlayerClient) generateRequestBody(params ...interface{}) (*bytes.B
 	return bytes.NewBuffer(body), nil
 }
 
+// generateSensitiveRequestBody is generateRequestBody for parameters holding credentials,
+// it doesn't log the generated request.
+func (self SoftlayerClient) generateSensitiveRequestBody(params ...interface{}) (*bytes.Buffer, error) {
+	body, err := json.Marshal(&SoftLayerRequest{
+		Parameters: params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Generated a request with sensitive parameters (contents not logged)")
+
+	return bytes.NewBuffer(body), nil
+}
+
+// SoftlayerError is an error reported by the SoftLayer API, Code is the name of the SoftLayer exception.
+type SoftlayerError struct {
+	Code    string
+	Message string
+}
+
+func (self *SoftlayerError) Error() string {
+	return self.Message
+}
+
+// isNotFound reports whether an API call failed because the object it refers to doesn't exist.
+func isNotFound(err error) bool {
+	softlayerErr, ok := err.(*SoftlayerError)
+	return ok && softlayerErr.Code == "SoftLayer_Exception_ObjectNotFound"
+}
+
 func (self SoftlayerClient) hasErrors(body map[string]interface{}) error {
 	if errString, ok := body["error"]; !ok {
 		return nil
 	} else {
-		return errors.New(errString.(string))
+		code, _ := body["code"].(string)
+		return &SoftlayerError{Code: code, Message: errString.(string)}
 	}
 }
 
 func (self SoftlayerClient) doRawHttpRequest(path string, requestType string, requestBody *bytes.Buffer) ([]byte, error) {
+	responseBody, err := self.sendHttpRequest(path, requestType, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Received response from SoftLayer: %s", responseBody)
+	return responseBody, nil
+}
+
+// sendHttpRequest performs an API request without logging the response, which may contain secrets.
+func (self SoftlayerClient) sendHttpRequest(path string, requestType string, requestBody *bytes.Buffer) ([]byte, error) {
 	url := fmt.Sprintf("https://%s:%s@%s/%s", self.user, self.apiKey, SOFTLAYER_API_URL, path)
 	log.Printf("Sending new request to softlayer: %s", url)
 
@@ -166,7 +233,6 @@ func (self SoftlayerClient) doRawHttpRequest(path string, requestType string, re
 		return nil, err
 	}
 
-	log.Printf("Received response from SoftLayer: %s", responseBody)
 	return responseBody, nil
 }
 
@@ -177,8 +243,29 @@ func (self SoftlayerClient) doHttpRequest(path string, requestType string, reque
 		return nil, err
 	}
 
+	return self.decodeResponse(responseBody)
+}
+
+// doSensitiveHttpRequest is doHttpRequest for responses that contain secrets, which are kept out of the logs.
+func (self SoftlayerClient) doSensitiveHttpRequest(path string, requestType string, requestBody *bytes.Buffer) ([]interface{}, error) {
+	responseBody, err := self.sendHttpRequest(path, requestType, requestBody)
+	if err != nil {
+		err := errors.New(fmt.Sprintf("Failed to get proper HTTP response from SoftLayer API"))
+		return nil, err
+	}
+
+	data, err := self.decodeResponse(responseBody)
+	if _, isApiError := err.(*SoftlayerError); err != nil && !isApiError {
+		// The decoding error quotes the response
+		return nil, errors.New("Failed to decode JSON response from SoftLayer")
+	}
+
+	return data, err
+}
+
+func (self SoftlayerClient) decodeResponse(responseBody []byte) ([]interface{}, error) {
 	var decodedResponse interface{}
-	err = json.Unmarshal(responseBody, &decodedResponse)
+	err := json.Unmarshal(responseBody, &decodedResponse)
 	if err != nil {
 		err := errors.New(fmt.Sprintf("Failed to decode JSON response from SoftLayer: %s | %s", responseBody, err))
 		return nil, err
@@ -201,16 +288,7 @@ func (self SoftlayerClient) doHttpRequest(path string, requestType string, reque
 	}
 }
 
-func (self SoftlayerClient) CreateInstance(instance InstanceType) (map[string]interface{}, error) {
-	// SoftLayer API puts some limitations on hostname and domain fields of the request
-	validName, err := regexp.Compile("[^A-Za-z0-9\\-\\.]+")
-	if err != nil {
-		return nil, err
-	}
-
-	instance.HostName = validName.ReplaceAllString(instance.HostName, "")
-	instance.Domain = validName.ReplaceAllString(instance.Domain, "")
-
+func (self SoftlayerClient) generateInstanceRequest(instance InstanceType) *InstanceReq {
 	// Construct the instance request object which will be decoded into json and posted to the API
 	instanceRequest := &InstanceReq{
 		HostName: instance.HostName,
@@ -237,6 +315,12 @@ func (self SoftlayerClient) CreateInstance(instance InstanceType) (map[string]in
 		}
 	}
 
+	for _, keyId := range instance.SshKeyIds {
+		instanceRequest.SshKeys = append(instanceRequest.SshKeys, &SshKey{Id: keyId})
+	}
+
+	instanceRequest.PrivateNetworkOnlyFlag = instance.PrivateNetworkOnly
+
 	if instance.BaseImageId != "" {
 		instanceRequest.BlockDeviceTemplateGroup = &BlockDeviceTemplateGroup{
 			Id: instance.BaseImageId,
@@ -253,7 +337,11 @@ func (self SoftlayerClient) CreateInstance(instance InstanceType) (map[string]in
 		}
 	}
 
-	requestBody, err := self.generateRequestBody(instanceRequest)
+	return instanceRequest
+}
+
+func (self SoftlayerClient) CreateInstance(instance InstanceType) (map[string]interface{}, error) {
+	requestBody, err := self.generateRequestBody(self.generateInstanceRequest(instance))
 	if err != nil {
 		return nil, err
 	}
@@ -266,6 +354,46 @@ func (self SoftlayerClient) CreateInstance(instance InstanceType) (map[string]in
 	return data[0].(map[string]interface{}), err
 }
 
+func (self SoftlayerClient) getCreateObjectOptions() (map[string]interface{}, error) {
+	data, err := self.doHttpRequest("SoftLayer_Virtual_Guest/getCreateObjectOptions.json", "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[0].(map[string]interface{}), err
+}
+
+// generateOrderTemplate lets SoftLayer validate an instance request and translate it into an order,
+// without actually placing the order.
+func (self SoftlayerClient) generateOrderTemplate(instance InstanceType) (map[string]interface{}, error) {
+	requestBody, err := self.generateRequestBody(self.generateInstanceRequest(instance))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := self.doHttpRequest("SoftLayer_Virtual_Guest/generateOrderTemplate.json", "POST", requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[0].(map[string]interface{}), err
+}
+
+// verifyOrder lets SoftLayer price an order (as returned by generateOrderTemplate) without placing it.
+func (self SoftlayerClient) verifyOrder(order map[string]interface{}) (map[string]interface{}, error) {
+	requestBody, err := self.generateRequestBody(order)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := self.doHttpRequest("SoftLayer_Product_Order/verifyOrder.json", "POST", requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[0].(map[string]interface{}), err
+}
+
 func (self SoftlayerClient) DestroyInstance(instanceId string) error {
 	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest/%s.json", instanceId), "DELETE", new(bytes.Buffer))
 
@@ -278,10 +406,11 @@ func (self SoftlayerClient) DestroyInstance(instanceId string) error {
 	return err
 }
 
-func (self SoftlayerClient) UploadSshKey(label string, publicKey string) (keyId int64, err error) {
+func (self SoftlayerClient) UploadSshKey(label string, publicKey string, notes string) (keyId int64, err error) {
 	sshKeyRequest := &SshKey{
 		Key:   publicKey,
 		Label: label,
+		Notes: notes,
 	}
 
 	requestBody, err := self.generateRequestBody(sshKeyRequest)
@@ -297,6 +426,36 @@ func (self SoftlayerClient) UploadSshKey(label string, publicKey string) (keyId
 	return int64(data[0].(map[string]interface{})["id"].(float64)), err
 }
 
+// getSshKeys lists the ssh keys registered in the account.
+func (self SoftlayerClient) getSshKeys() ([]interface{}, error) {
+	mask := url.QueryEscape("mask[id,label,fingerprint,key,notes]")
+	data, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Account/getSshKeys.json?objectMask=%s", mask), "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (self SoftlayerClient) setSshKeyNotes(keyId int64, notes string) error {
+	requestBody, err := self.generateRequestBody(&SshKey{Notes: notes})
+	if err != nil {
+		return err
+	}
+
+	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Security_Ssh_Key/%d/editObject.json", keyId), "POST", requestBody)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Edited the notes of an SSH key with id (%d), response: %s", keyId, response)
+	if res := string(response[:]); res != "true" {
+		return errors.New(fmt.Sprintf("Failed to edit the notes of an SSH key with id '%d', got '%s' as response from the API.", keyId, res))
+	}
+
+	return nil
+}
+
 func (self SoftlayerClient) DestroySshKey(keyId int64) error {
 	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Security_Ssh_Key/%v.json", int(keyId)), "DELETE", new(bytes.Buffer))
 
@@ -320,6 +479,70 @@ func (self SoftlayerClient) getInstancePublicIp(instanceId string) (string, erro
 	return string(ipAddress), nil
 }
 
+// getInstancePassword returns the password the operating system of an instance was provisioned with for
+// the given user, or an empty string if it isn't available yet.
+func (self SoftlayerClient) getInstancePassword(instanceId string, username string) (string, error) {
+	mask := url.QueryEscape("mask[passwords[username,password]]")
+	data, err := self.doSensitiveHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest/%s/getOperatingSystem.json?objectMask=%s", instanceId, mask), "GET", nil)
+	if err != nil {
+		return "", err
+	}
+
+	operatingSystem, ok := data[0].(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+
+	passwords, _ := operatingSystem["passwords"].([]interface{})
+	for _, val := range passwords {
+		credentials, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if user, _ := credentials["username"].(string); strings.EqualFold(user, username) {
+			password, _ := credentials["password"].(string)
+			return password, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (self SoftlayerClient) getInstanceBackendIp(instanceId string) (string, error) {
+	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest/%s/getPrimaryBackendIpAddress.json", instanceId), "GET", nil)
+	if err != nil {
+		return "", err
+	}
+
+	return parseIpAddress(response)
+}
+
+// parseIpAddress reads the IP address an API call returns as a JSON string.
+func parseIpAddress(response []byte) (string, error) {
+	var ipAddress string
+	if err := json.Unmarshal(response, &ipAddress); err != nil {
+		return "", fmt.Errorf("Unexpected response '%s': %s", response, err)
+	}
+
+	if net.ParseIP(ipAddress) == nil {
+		return "", fmt.Errorf("Invalid IP address '%s' in the response", ipAddress)
+	}
+
+	return ipAddress, nil
+}
+
+// getVirtualGuests lists the instances of the account.
+func (self SoftlayerClient) getVirtualGuests() ([]interface{}, error) {
+	mask := url.QueryEscape("mask[id,globalIdentifier,hostname,fullyQualifiedDomainName,createDate,primaryIpAddress,primaryBackendIpAddress,tagReferences[tag[name]]]")
+	data, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Account/getVirtualGuests.json?objectMask=%s", mask), "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
 func (self SoftlayerClient) getBlockDevices(instanceId string) ([]interface{}, error) {
 	data, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest/%s/getBlockDevices.json?objectMask=mask.diskImage.name", instanceId), "GET", nil)
 	if err != nil {
@@ -349,7 +572,8 @@ func (self SoftlayerClient) findNonSwapBlockDeviceIds(blockDevices []interface{}
 }
 
 func (self SoftlayerClient) getBlockDeviceTemplateGroups() ([]interface{}, error) {
-	data, err := self.doHttpRequest("SoftLayer_Account/getBlockDeviceTemplateGroups.json", "GET", nil)
+	mask := url.QueryEscape("mask[id,globalIdentifier,name,createDate,transactionId,datacenters[name],tagReferences[tag[name]]]")
+	data, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Account/getBlockDeviceTemplateGroups.json?objectMask=%s", mask), "GET", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -357,30 +581,147 @@ func (self SoftlayerClient) getBlockDeviceTemplateGroups() ([]interface{}, error
 	return data, nil
 }
 
-func (self SoftlayerClient) findImageIdByName(imageName string) (string, error) {
-	// Find the image id by listing all images and matching on name.
-	var imageId string
+// findImageByGlobalIdentifier returns the template group of the account with the given global id.
+func (self SoftlayerClient) findImageByGlobalIdentifier(globalIdentifier string) (map[string]interface{}, error) {
 	images, err := self.getBlockDeviceTemplateGroups()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	for _, val := range images {
-		image := val.(map[string]interface{})
-		if image["name"] == imageName && image["globalIdentifier"] != nil {
-			imageId = image["globalIdentifier"].(string)
-			break
+		image, ok := val.(map[string]interface{})
+		if ok && image["globalIdentifier"] == globalIdentifier {
+			return image, nil
 		}
 	}
 
-	if imageId == "" {
-		err = fmt.Errorf("No image found with name '%s'.", imageName)
-		return "", err
+	return nil, fmt.Errorf("Could not find an image with id '%s' in the account", globalIdentifier)
+}
+
+// findImageByTransaction returns the image a transaction (e.g. from createArchiveTransaction) works on,
+// or nil if there is no such image (yet). SoftLayer clears the transaction of the image as soon as it
+// finishes, the image is then the new one named imageName: one that isn't among the knownIds listed
+// before the capture.
+func (self SoftlayerClient) findImageByTransaction(transactionId int64, imageName string, knownIds []int64) (map[string]interface{}, error) {
+	images, err := self.getBlockDeviceTemplateGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	if image := imageWithTransaction(images, transactionId); image != nil {
+		return image, nil
+	}
+
+	complete, err := self.isTransactionComplete(transactionId)
+	if err != nil || !complete {
+		return nil, err
+	}
+
+	image, err := findNewImageByName(images, imageName, knownIds)
+	if err != nil {
+		return nil, fmt.Errorf("The transaction (id=%d) completed before its image was found: %s", transactionId, err)
+	}
+
+	return image, nil
+}
+
+func (self SoftlayerClient) waitForImageByTransaction(transactionId int64, imageName string, knownIds []int64, timeout time.Duration) (map[string]interface{}, error) {
+	var image map[string]interface{}
+	err := self.waitFor("image of the transaction", timeout, func() (bool, error) {
+		var err error
+		image, err = self.findImageByTransaction(transactionId, imageName, knownIds)
+		return image != nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// isTransactionComplete reports whether a provisioning transaction finished. SoftLayer removes
+// transactions once they are done, so a transaction that can't be found is complete too.
+func (self SoftlayerClient) isTransactionComplete(transactionId int64) (bool, error) {
+	mask := url.QueryEscape("mask[id,transactionStatus[name]]")
+	data, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Provisioning_Version1_Transaction/%d/getObject.json?objectMask=%s", transactionId, mask), "GET", nil)
+	if isNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
 	}
 
-	return imageId, nil;
+	status, _ := lookupOptionValue(data[0], "transactionStatus", "name")
+	return status == "COMPLETE", nil
 }
 
+// imageWithTransaction returns the image, out of a list of template groups, with the given pending transaction.
+func imageWithTransaction(images []interface{}, transactionId int64) map[string]interface{} {
+	for _, val := range images {
+		image, ok := val.(map[string]interface{})
+		if !ok || image["globalIdentifier"] == nil {
+			continue
+		}
+
+		if id, ok := image["transactionId"].(float64); ok && int64(id) == transactionId {
+			return image
+		}
+	}
+
+	return nil
+}
+
+// findNewImageByName returns the only image, out of a list of template groups, named imageName
+// whose id isn't one of the knownIds.
+func findNewImageByName(images []interface{}, imageName string, knownIds []int64) (map[string]interface{}, error) {
+	var matches []map[string]interface{}
+	for _, val := range images {
+		image, ok := val.(map[string]interface{})
+		if !ok || image["globalIdentifier"] == nil || image["name"] != imageName {
+			continue
+		}
+
+		if id, ok := image["id"].(float64); ok && !containsInt64(knownIds, int64(id)) {
+			matches = append(matches, image)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no new image named '%s'", imageName)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%d new images named '%s', can't tell which one was captured", len(matches), imageName)
+	}
+}
+
+// imageIds returns the ids of a list of template groups.
+func imageIds(images []interface{}) []int64 {
+	var ids []int64
+	for _, val := range images {
+		image, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if id, ok := image["id"].(float64); ok {
+			ids = append(ids, int64(id))
+		}
+	}
+
+	return ids
+}
+
+func containsInt64(values []int64, value int64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
 
 func (self SoftlayerClient) captureStandardImage(instanceId string, imageName string, imageDescription string, blockDeviceIds []int64) (map[string]interface{}, error) {
 	blockDevices := make([]*BlockDevice, len(blockDeviceIds))
@@ -423,15 +764,470 @@ func (self SoftlayerClient) captureImage(instanceId string, imageName string, im
 	return data[0].(map[string]interface{}), err
 }
 
-func (self SoftlayerClient) destroyImage(imageId string) error {
-	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest/%s.json", imageId), "DELETE", new(bytes.Buffer))
+// destroyImage deletes the image with the given global id, including its copies in every datacenter,
+// and waits for the deletion to finish.
+func (self SoftlayerClient) destroyImage(imageId string, timeout time.Duration) error {
+	image, err := self.findImageByGlobalIdentifier(imageId)
+	if err != nil {
+		return err
+	}
+
+	templateGroupId := int64(image["id"].(float64))
+	image, err = self.getImage(templateGroupId, "mask[id,children[id]]")
+	if err != nil {
+		return err
+	}
+
+	templateGroupIds := []int64{templateGroupId}
+	children, _ := image["children"].([]interface{})
+	for _, child := range children {
+		templateGroupIds = append(templateGroupIds, int64(child.(map[string]interface{})["id"].(float64)))
+	}
 
-	log.Printf("Deleted an image with id (%s), response: %s", imageId, response)
+	err = self.deleteImage(templateGroupId)
+	if err != nil {
+		return err
+	}
+
+	return self.waitFor("image deletion", timeout, func() (bool, error) {
+		for _, id := range templateGroupIds {
+			_, err := self.getImage(id, "mask[id]")
+			if err == nil {
+				return false, nil
+			}
+
+			if !isNotFound(err) {
+				return false, err
+			}
+		}
+
+		return true, nil
+	})
+}
+
+func (self SoftlayerClient) setInstanceTags(instanceId string, tags []string) error {
+	requestBody, err := self.generateRequestBody(strings.Join(tags, ","))
+	if err != nil {
+		return err
+	}
+
+	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest/%s/setTags.json", instanceId), "POST", requestBody)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Tagged an instance with id (%s), response: %s", instanceId, response)
 	if res := string(response[:]); res != "true" {
-		return errors.New(fmt.Sprintf("Failed to destroy and image wit id '%s', got '%s' as response from the API.", imageId, res))
+		return errors.New(fmt.Sprintf("Failed to tag an instance with id '%s', got '%s' as response from the API.", instanceId, res))
 	}
 
-	return err
+	return nil
+}
+
+func (self SoftlayerClient) setImageTags(templateGroupId int64, tags []string) error {
+	requestBody, err := self.generateRequestBody(strings.Join(tags, ","))
+	if err != nil {
+		return err
+	}
+
+	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%d/setTags.json", templateGroupId), "POST", requestBody)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Tagged an image with id (%d), response: %s", templateGroupId, response)
+	if res := string(response[:]); res != "true" {
+		return errors.New(fmt.Sprintf("Failed to tag an image with id '%d', got '%s' as response from the API.", templateGroupId, res))
+	}
+
+	return nil
+}
+
+func (self SoftlayerClient) getDatacenters() ([]interface{}, error) {
+	data, err := self.doHttpRequest("SoftLayer_Location_Datacenter/getDatacenters.json", "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// findDatacenterIds resolves datacenter names (e.g. "dal10") into their location ids.
+func (self SoftlayerClient) findDatacenterIds(datacenterNames []string) ([]int64, error) {
+	datacenters, err := self.getDatacenters()
+	if err != nil {
+		return nil, err
+	}
+
+	datacenterIds := make([]int64, len(datacenterNames))
+	for i, name := range datacenterNames {
+		for _, val := range datacenters {
+			datacenter := val.(map[string]interface{})
+			if datacenter["name"] == name {
+				datacenterIds[i] = int64(datacenter["id"].(float64))
+				break
+			}
+		}
+
+		if datacenterIds[i] == 0 {
+			return nil, fmt.Errorf("No datacenter found with name '%s'.", name)
+		}
+	}
+
+	return datacenterIds, nil
+}
+
+func (self SoftlayerClient) addImageLocations(templateGroupId int64, datacenterIds []int64) error {
+	locations := make([]*Location, len(datacenterIds))
+	for i, id := range datacenterIds {
+		locations[i] = &Location{
+			Id: id,
+		}
+	}
+
+	requestBody, err := self.generateRequestBody(locations)
+	if err != nil {
+		return err
+	}
+
+	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%d/addLocations.json", templateGroupId), "POST", requestBody)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Added locations to an image with id (%d), response: %s", templateGroupId, response)
+	if res := string(response[:]); res != "true" {
+		return errors.New(fmt.Sprintf("Failed to add locations to an image with id '%d', got '%s' as response from the API.", templateGroupId, res))
+	}
+
+	return nil
+}
+
+// getImageChildren returns the per datacenter copies of an image.
+func (self SoftlayerClient) getImageChildren(templateGroupId int64) ([]interface{}, error) {
+	mask := url.QueryEscape("mask[id,globalIdentifier,transactionId,datacenter[name]]")
+	data, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%d/getChildren.json?objectMask=%s", templateGroupId, mask), "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// areImageLocationsReady checks that the image has a copy without pending transactions in every datacenter.
+func (self SoftlayerClient) areImageLocationsReady(templateGroupId int64, datacenterNames []string) (bool, error) {
+	children, err := self.getImageChildren(templateGroupId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, name := range datacenterNames {
+		ready := false
+		for _, val := range children {
+			child, ok := val.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			datacenter, _ := child["datacenter"].(map[string]interface{})
+			if datacenter != nil && datacenter["name"] == name && child["transactionId"] == nil {
+				ready = true
+				break
+			}
+		}
+
+		if !ready {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (self SoftlayerClient) waitForImageLocationsReady(templateGroupId int64, datacenterNames []string, timeout time.Duration) error {
+	return self.waitFor("image locations", timeout, func() (bool, error) {
+		return self.areImageLocationsReady(templateGroupId, datacenterNames)
+	})
+}
+
+func (self SoftlayerClient) permitImageSharing(templateGroupId int64, accountId int) error {
+	requestBody, err := self.generateRequestBody(accountId)
+	if err != nil {
+		return err
+	}
+
+	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%d/permitSharingAccess.json", templateGroupId), "POST", requestBody)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Shared an image with id (%d) with account (%d), response: %s", templateGroupId, accountId, response)
+	if res := string(response[:]); res != "true" {
+		return errors.New(fmt.Sprintf("Failed to share an image with id '%d' with account '%d', got '%s' as response from the API.", templateGroupId, accountId, res))
+	}
+
+	return nil
+}
+
+func (self SoftlayerClient) denyImageSharing(templateGroupId int64, accountId int) error {
+	requestBody, err := self.generateRequestBody(accountId)
+	if err != nil {
+		return err
+	}
+
+	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%d/denySharingAccess.json", templateGroupId), "POST", requestBody)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Stopped sharing an image with id (%d) with account (%d), response: %s", templateGroupId, accountId, response)
+	if res := string(response[:]); res != "true" {
+		return errors.New(fmt.Sprintf("Failed to stop sharing an image with id '%d' with account '%d', got '%s' as response from the API.", templateGroupId, accountId, res))
+	}
+
+	return nil
+}
+
+// getImageSharedAccounts returns the ids of the accounts an image is shared with.
+func (self SoftlayerClient) getImageSharedAccounts(templateGroupId int64) ([]int, error) {
+	data, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%d/getAccountReferences.json", templateGroupId), "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	accountIds := make([]int, 0, len(data))
+	for _, val := range data {
+		reference, ok := val.(map[string]interface{})
+		if !ok || reference["accountId"] == nil {
+			continue
+		}
+
+		accountIds = append(accountIds, int(reference["accountId"].(float64)))
+	}
+
+	return accountIds, nil
+}
+
+func (self SoftlayerClient) getImage(templateGroupId int64, mask string) (map[string]interface{}, error) {
+	data, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%d/getObject.json?objectMask=%s", templateGroupId, url.QueryEscape(mask)), "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[0].(map[string]interface{}), err
+}
+
+// isImageIdle checks that neither the image nor any of its per datacenter copies have a pending transaction.
+func (self SoftlayerClient) isImageIdle(templateGroupId int64) (bool, error) {
+	image, err := self.getImage(templateGroupId, "mask[id,transactionId,children[id,transactionId]]")
+	if err != nil {
+		return false, err
+	}
+
+	if image["transactionId"] != nil {
+		return false, nil
+	}
+
+	children, _ := image["children"].([]interface{})
+	for _, val := range children {
+		child, ok := val.(map[string]interface{})
+		if ok && child["transactionId"] != nil {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// waitForImageTransaction waits for the transaction of an export or an import to complete. SoftLayer
+// attaches the transaction to the image asynchronously, so an idle image only counts once the transaction
+// was seen: right after the request the image is idle because the transaction didn't start yet.
+func (self SoftlayerClient) waitForImageTransaction(templateGroupId int64, timeout time.Duration) error {
+	started := false
+	return self.waitFor("image transaction", timeout, func() (bool, error) {
+		idle, err := self.isImageIdle(templateGroupId)
+		if err != nil {
+			return false, err
+		}
+
+		if !idle {
+			started = true
+		}
+
+		return started && idle, nil
+	})
+}
+
+// The image properties waitForImageReady looks at
+const imageReadinessMask = "mask[id,status[keyName],transaction[elapsedSeconds,transactionStatus[name,averageDuration]]," +
+	"children[id,transaction[elapsedSeconds,transactionStatus[name,averageDuration]],blockDevices[device,diskImage[bootableVolumeFlag]]]]"
+
+// waitForImageReady waits for a newly created image to be usable. The progress function, if not nil,
+// receives the estimated completion percentage on every check.
+func (self SoftlayerClient) waitForImageReady(templateGroupId int64, timeout time.Duration, progress func(int)) error {
+	return self.waitFor("image", timeout, func() (bool, error) {
+		image, err := self.getImage(templateGroupId, imageReadinessMask)
+		if err != nil {
+			return false, err
+		}
+
+		ready, percent, err := self.imageReadiness(image)
+		if progress != nil {
+			progress(percent)
+		}
+
+		return ready, err
+	})
+}
+
+// imageReadiness tells whether an image (as fetched with imageReadinessMask) is ready. An image is ready
+// once it is active, has no pending transactions and has block devices in every datacenter. The estimated
+// completion percentage is derived from the average duration of the pending transactions.
+func (self SoftlayerClient) imageReadiness(image map[string]interface{}) (bool, int, error) {
+	children, _ := image["children"].([]interface{})
+
+	// Estimate the progress of the slowest pending transaction
+	var transactions []interface{}
+	if image["transaction"] != nil {
+		transactions = append(transactions, image["transaction"])
+	}
+	for _, child := range children {
+		if transaction, ok := lookupOptionValue(child, "transaction"); ok && transaction != nil {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	if len(transactions) > 0 {
+		percent := 99
+		for _, transaction := range transactions {
+			elapsed, _ := lookupOptionValue(transaction, "elapsedSeconds")
+			averageDuration, _ := lookupOptionValue(transaction, "transactionStatus", "averageDuration")
+			expected := parseFloat(averageDuration) * 60
+			if expected <= 0 {
+				percent = 0
+				continue
+			}
+
+			if transactionPercent := int(parseFloat(elapsed) / expected * 100); transactionPercent < percent {
+				percent = transactionPercent
+			}
+		}
+
+		return false, percent, nil
+	}
+
+	if status, ok := lookupOptionValue(image, "status", "keyName"); ok && status != "ACTIVE" {
+		return false, 99, nil
+	}
+
+	if len(children) == 0 {
+		return false, 99, nil
+	}
+
+	// Every datacenter copy needs its disks, and one of them must be able to boot
+	bootable, bootableKnown := false, false
+	for _, val := range children {
+		blockDevices, _ := lookupOptionValue(val, "blockDevices")
+		if devices, ok := blockDevices.([]interface{}); !ok || len(devices) == 0 {
+			return false, 99, nil
+		}
+
+		for _, device := range blockDevices.([]interface{}) {
+			if flag, ok := lookupOptionValue(device, "diskImage", "bootableVolumeFlag"); ok && flag != nil {
+				bootableKnown = true
+				bootable = bootable || flag == true || flag == 1.
+			}
+		}
+	}
+
+	if bootableKnown && !bootable {
+		return false, 100, errors.New("The image has no bootable disk")
+	}
+
+	return true, 100, nil
+}
+
+// parseFloat reads a numeric field, which the SoftLayer API returns either as a string or as a number.
+// Missing or malformed values read as 0.
+func parseFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0
+		}
+		return number
+	default:
+		return 0
+	}
+}
+
+// copyImageToIcos exports the image to IBM Cloud Object Storage, the uri has the form cos://<region>/<bucket>/<object>.
+func (self SoftlayerClient) copyImageToIcos(templateGroupId int64, configuration *ImageTransferConfiguration) error {
+	return self.transferImage(templateGroupId, "copyToIcos", configuration)
+}
+
+// copyImageToExternalSource exports the image to Swift object storage, the uri has the form swift://<account>@<cluster>/<container>/<object>.
+func (self SoftlayerClient) copyImageToExternalSource(templateGroupId int64, configuration *ImageTransferConfiguration) error {
+	return self.transferImage(templateGroupId, "copyToExternalSource", configuration)
+}
+
+// createImageFromIcos imports an image file from IBM Cloud Object Storage.
+func (self SoftlayerClient) createImageFromIcos(configuration *ImageTransferConfiguration) (map[string]interface{}, error) {
+	return self.importImage("createFromIcos", configuration)
+}
+
+// createImageFromExternalSource imports an image file from Swift object storage.
+func (self SoftlayerClient) createImageFromExternalSource(configuration *ImageTransferConfiguration) (map[string]interface{}, error) {
+	return self.importImage("createFromExternalSource", configuration)
+}
+
+func (self SoftlayerClient) importImage(method string, configuration *ImageTransferConfiguration) (map[string]interface{}, error) {
+	requestBody, err := self.generateSensitiveRequestBody(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%s.json", method), "POST", requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[0].(map[string]interface{}), err
+}
+
+// deleteImage deletes an image (template group) through deleteObject, SoftLayer deletes it and its
+// datacenter copies asynchronously by a transaction.
+func (self SoftlayerClient) deleteImage(templateGroupId int64) error {
+	_, err := self.doHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%d.json", templateGroupId), "DELETE", new(bytes.Buffer))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Deleted an image with id (%d)", templateGroupId)
+
+	return nil
+}
+
+func (self SoftlayerClient) transferImage(templateGroupId int64, method string, configuration *ImageTransferConfiguration) error {
+	requestBody, err := self.generateSensitiveRequestBody(configuration)
+	if err != nil {
+		return err
+	}
+
+	response, err := self.doRawHttpRequest(fmt.Sprintf("SoftLayer_Virtual_Guest_Block_Device_Template_Group/%d/%s.json", templateGroupId, method), "POST", requestBody)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Requested %s for an image with id (%d), response: %s", method, templateGroupId, response)
+	if res := string(response[:]); res != "true" {
+		return errors.New(fmt.Sprintf("Failed to %s an image with id '%d', got '%s' as response from the API.", method, templateGroupId, res))
+	}
+
+	return nil
 }
 
 func (self SoftlayerClient) isInstanceReady(instanceId string) (bool, error) {
@@ -451,47 +1247,60 @@ func (self SoftlayerClient) isInstanceReady(instanceId string) (bool, error) {
 }
 
 func (self SoftlayerClient) waitForInstanceReady(instanceId string, timeout time.Duration) error {
+	return self.waitFor("instance", timeout, func() (bool, error) {
+		return self.isInstanceReady(instanceId)
+	})
+}
+
+// waitFor polls isReady until it reports that the subject (e.g. "instance") is ready,
+// it fails or the timeout expires.
+func (self SoftlayerClient) waitFor(subject string, timeout time.Duration, isReady func() (bool, error)) error {
 	done := make(chan struct{})
 	defer close(done)
 	result := make(chan error, 1)
 
+	// stopped tells whether waitFor returned, e.g. because it timed out while a check was running
+	stopped := func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+
 	go func() {
 		attempts := 0
-		for {
+		for !stopped() {
 			attempts += 1
 
-			log.Printf("Checking instance status... (attempt: %d)", attempts)
-			isReady, err := self.isInstanceReady(instanceId)
+			log.Printf("Checking %s status... (attempt: %d)", subject, attempts)
+			ready, err := isReady()
+			if stopped() {
+				return
+			}
+
 			if err != nil {
 				result <- err
 				return
 			}
 
-			if isReady {
+			if ready {
 				result <- nil
 				return
 			}
 
 			// Wait 3 seconds in between
 			time.Sleep(3 * time.Second)
-
-			// Verify we shouldn't exit
-			select {
-			case <-done:
-				// We finished, so just exit the goroutine
-				return
-			default:
-				// Keep going
-			}
 		}
 	}()
 
-	log.Printf("Waiting for up to %d seconds for instance to become ready", timeout/time.Second)
+	log.Printf("Waiting for up to %d seconds for %s to become ready", timeout/time.Second, subject)
 	select {
 	case err := <-result:
 		return err
 	case <-time.After(timeout):
-		err := fmt.Errorf("Timeout while waiting to for the instance to become ready")
+		err := fmt.Errorf("Timeout while waiting to for the %s to become ready", subject)
 		return err
 	}
 }
@@ -87,3 +87,126 @@ func TestClient_FindNonSwapBlockDeviceIds(t *testing.T) {
 	}
 }
 
+func TestClient_ImageReadiness(t *testing.T) {
+	client := SoftlayerClient{}
+
+	child := func(transaction interface{}, bootable interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":          2.,
+			"transaction": transaction,
+			"blockDevices": []interface{}{
+				map[string]interface{}{
+					"device":    "0",
+					"diskImage": map[string]interface{}{"bootableVolumeFlag": bootable},
+				},
+			},
+		}
+	}
+
+	pending := map[string]interface{}{
+		"elapsedSeconds":    30.,
+		"transactionStatus": map[string]interface{}{"name": "CLONE_CCI", "averageDuration": "2"},
+	}
+	image := map[string]interface{}{
+		"status":   map[string]interface{}{"keyName": "ACTIVE"},
+		"children": []interface{}{child(pending, true)},
+	}
+	ready, percent, err := client.imageReadiness(image)
+	if ready || percent != 25 || err != nil {
+		t.Fatalf("Expected a pending image at 25%% but got: %v, %d, %v", ready, percent, err)
+	}
+
+	image["children"] = []interface{}{child(nil, true)}
+	ready, percent, err = client.imageReadiness(image)
+	if !ready || percent != 100 || err != nil {
+		t.Fatalf("Expected a ready image but got: %v, %d, %v", ready, percent, err)
+	}
+
+	image["children"] = []interface{}{map[string]interface{}{"id": 2., "blockDevices": []interface{}{}}}
+	ready, _, err = client.imageReadiness(image)
+	if ready || err != nil {
+		t.Fatalf("Expected an image without block devices not to be ready but got: %v, %v", ready, err)
+	}
+
+	image["children"] = []interface{}{child(nil, false)}
+	if _, _, err = client.imageReadiness(image); err == nil {
+		t.Fatal("Expected an error for an image without a bootable disk")
+	}
+}
+
+func TestClient_HasErrors(t *testing.T) {
+	client := SoftlayerClient{}
+
+	if err := client.hasErrors(map[string]interface{}{"id": 1.}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	err := client.hasErrors(map[string]interface{}{
+		"error": "Unable to find object with id of '1234'.",
+		"code":  "SoftLayer_Exception_ObjectNotFound",
+	})
+	if err == nil || err.Error() != "Unable to find object with id of '1234'." {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !isNotFound(err) {
+		t.Fatal("Expected a not found error")
+	}
+
+	err = client.hasErrors(map[string]interface{}{
+		"error": "Access Denied.",
+		"code":  "SoftLayer_Exception_Public",
+	})
+	if isNotFound(err) {
+		t.Fatal("Expected an error other than not found")
+	}
+}
+
+func TestClient_FindCapturedImage(t *testing.T) {
+	images := []interface{}{
+		map[string]interface{}{"id": 1., "globalIdentifier": "a", "name": "centos"},
+		map[string]interface{}{"id": 2., "globalIdentifier": "b", "name": "centos", "transactionId": 77.},
+		map[string]interface{}{"id": 3., "globalIdentifier": "c", "name": "ubuntu"},
+	}
+
+	if image := imageWithTransaction(images, 77); image == nil || image["globalIdentifier"] != "b" {
+		t.Fatalf("Expected image b but got %v", image)
+	}
+
+	if image := imageWithTransaction(images, 78); image != nil {
+		t.Fatalf("Expected no image but got %v", image)
+	}
+
+	// Once the transaction is cleared, the captured image is the new one with the name
+	knownIds := imageIds(images[:1])
+	image, err := findNewImageByName(images, "centos", knownIds)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if image["globalIdentifier"] != "b" {
+		t.Fatalf("Expected image b but got %v", image)
+	}
+
+	if _, err := findNewImageByName(images, "centos", nil); err == nil {
+		t.Fatal("Expected an error for several new images with the name")
+	}
+
+	if _, err := findNewImageByName(images, "centos", imageIds(images)); err == nil {
+		t.Fatal("Expected an error without a new image")
+	}
+}
+
+func TestClient_ParseIpAddress(t *testing.T) {
+	ipAddress, err := parseIpAddress([]byte(`"10.0.0.12"`))
+	if err != nil || ipAddress != "10.0.0.12" {
+		t.Fatalf("Unexpected result '%s': %v", ipAddress, err)
+	}
+
+	invalid := []string{`"1234.5.6.7"`, `""`, `{"error": "Access Denied.", "code": "SoftLayer_Exception_Public"}`, `10.0.0.12`}
+	for _, response := range invalid {
+		if _, err := parseIpAddress([]byte(response)); err == nil {
+			t.Fatalf("Expected an error for the response %s", response)
+		}
+	}
+}
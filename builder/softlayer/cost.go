@@ -0,0 +1,91 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"math"
+	"strconv"
+	"time"
+)
+
+// estimateHourlyCost adds up the hourly item prices, as listed by
+// SoftLayer_Virtual_Guest::getCreateObjectOptions, of the resources ordered for the build instance.
+func estimateHourlyCost(config Config, options map[string]interface{}) float64 {
+	total := createObjectOptionPrice(options, "processors", nil, strconv.Itoa(config.InstanceCpu), "startCpus")
+	total += createObjectOptionPrice(options, "memory", nil, strconv.FormatInt(config.InstanceMemory, 10), "maxMemory")
+	total += createObjectOptionPrice(options, "networkComponents", nil, strconv.Itoa(config.InstanceNetworkSpeed), "networkComponents", "maxSpeed")
+
+	if config.BaseOsCode != "" {
+		total += createObjectOptionPrice(options, "operatingSystems", nil, config.BaseOsCode, "operatingSystemReferenceCode")
+		total += createObjectOptionPrice(options, "blockDevices", isPrimarySanDisk, strconv.Itoa(config.InstanceDiskCapacity), "blockDevices", "diskImage", "capacity")
+	}
+
+	return total
+}
+
+// createObjectOptionPrice returns the hourly price of the first option in a group whose template
+// has the given value at the given path.
+func createObjectOptionPrice(options map[string]interface{}, group string, filter func(map[string]interface{}) bool, value string, path ...string) float64 {
+	entries, _ := options[group].([]interface{})
+	for _, entry := range entries {
+		entryMap, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		template, ok := entryMap["template"].(map[string]interface{})
+		if !ok || (filter != nil && !filter(template)) {
+			continue
+		}
+
+		if templateValue, ok := lookupOptionValue(template, path...); !ok || fmt.Sprintf("%v", templateValue) != value {
+			continue
+		}
+
+		price, _ := lookupOptionValue(entryMap, "itemPrice", "hourlyRecurringFee")
+		return parseFloat(price)
+	}
+
+	return 0
+}
+
+// estimateCost returns the cost of running an hourly instance for the given duration.
+// SoftLayer bills every started hour.
+func estimateCost(hourlyCost float64, runtime time.Duration) float64 {
+	return hourlyCost * math.Ceil(runtime.Hours())
+}
+
+// reportBuildCost prints how long the build instance ran and its estimated cost, and returns the cost.
+// ok is false when no instance was created. An instance that wasn't destroyed is still running.
+func reportBuildCost(state multistep.StateBag) (float64, bool) {
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	createdAt, ok := state.GetOk("instance_created_at")
+	if !ok {
+		return 0, false
+	}
+
+	destroyedAt, destroyed := state.GetOk("instance_destroyed_at")
+	if !destroyed {
+		destroyedAt = time.Now()
+	}
+	runtime := destroyedAt.(time.Time).Sub(createdAt.(time.Time))
+
+	var hourlyCost float64
+	if options, ok := state.GetOk("create_object_options"); ok {
+		hourlyCost = estimateHourlyCost(config, options.(map[string]interface{}))
+	}
+	cost := estimateCost(hourlyCost, runtime)
+
+	runtime = runtime - runtime%time.Second
+	if destroyed {
+		ui.Say(fmt.Sprintf("The build instance ran for %s, estimated cost: %.4f (%.4f per hour)", runtime, cost, hourlyCost))
+	} else {
+		ui.Say(fmt.Sprintf("The build instance is still running, it ran for %s so far, estimated cost: %.4f (%.4f per hour)",
+			runtime, cost, hourlyCost))
+	}
+
+	return cost, true
+}
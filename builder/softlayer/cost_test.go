@@ -0,0 +1,48 @@
+package softlayer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCost_EstimateHourlyCost(t *testing.T) {
+	options := testCreateObjectOptions()
+	prices := map[string][]string{
+		"processors":        {"0.04", "0.01", "0.02"},
+		"memory":            {"0.015", "0.03"},
+		"networkComponents": {"0", "0.005"},
+		"operatingSystems":  {"0.002"},
+		"blockDevices":      {"0.003", "0.05", "0.1"},
+	}
+	for group, groupPrices := range prices {
+		for i, entry := range options[group].([]interface{}) {
+			entry.(map[string]interface{})["itemPrice"] = map[string]interface{}{
+				"hourlyRecurringFee": groupPrices[i],
+			}
+		}
+	}
+
+	// 1 cpu, 1024 memory, 10 network, CENTOS_6_64 and a 25G SAN disk
+	config := testPreflightConfig()
+	if cost := estimateHourlyCost(config, options); cost < 0.0299 || cost > 0.0301 {
+		t.Fatalf("Expected an hourly cost of 0.03 but got %f", cost)
+	}
+
+	// Images bring their own OS and disks
+	config.BaseOsCode = ""
+	config.BaseImageId = "some-image"
+	config.InstanceCpu = 4
+	if cost := estimateHourlyCost(config, options); cost < 0.0549 || cost > 0.0551 {
+		t.Fatalf("Expected an hourly cost of 0.055 but got %f", cost)
+	}
+}
+
+func TestCost_EstimateCost(t *testing.T) {
+	if cost := estimateCost(0.5, 10*time.Minute); cost != 0.5 {
+		t.Fatalf("Expected a started hour to be billed completely but got %f", cost)
+	}
+
+	if cost := estimateCost(0.5, 61*time.Minute); cost != 1 {
+		t.Fatalf("Expected two billed hours but got %f", cost)
+	}
+}
@@ -0,0 +1,132 @@
+package softlayer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// BaseImageFilterConfig selects the base image among the images of the account.
+type BaseImageFilterConfig struct {
+	Name       string   `mapstructure:"name"`
+	Tags       []string `mapstructure:"tags"`
+	Datacenter string   `mapstructure:"datacenter"`
+	MostRecent bool     `mapstructure:"most_recent"`
+}
+
+// IsSet reports whether any of the options were configured.
+func (self *BaseImageFilterConfig) IsSet() bool {
+	return self.Name != "" || len(self.Tags) > 0 || self.Datacenter != "" || self.MostRecent
+}
+
+// Prepare validates the configuration.
+func (self *BaseImageFilterConfig) Prepare() []error {
+	var errs []error
+
+	if self.Name == "" && len(self.Tags) == 0 && self.Datacenter == "" {
+		errs = append(errs, errors.New("base_image_filter must specify at least one of name, tags or datacenter"))
+	}
+
+	if _, err := regexp.Compile(self.Name); err != nil {
+		errs = append(errs, fmt.Errorf("Invalid base_image_filter.name: %s", err))
+	}
+
+	return errs
+}
+
+// findMatchingImage returns the image, out of a list of template groups, selected by the filter.
+func findMatchingImage(images []interface{}, filter BaseImageFilterConfig) (map[string]interface{}, error) {
+	name, err := regexp.Compile(filter.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []map[string]interface{}
+	for _, val := range images {
+		image, ok := val.(map[string]interface{})
+		if !ok || image["globalIdentifier"] == nil {
+			continue
+		}
+
+		imageName, _ := image["name"].(string)
+		if !name.MatchString(imageName) {
+			continue
+		}
+
+		if filter.Datacenter != "" && !containsString(imageDatacenterNames(image), filter.Datacenter) {
+			continue
+		}
+
+		tags := tagNames(image)
+		hasTags := true
+		for _, tag := range filter.Tags {
+			if !containsString(tags, tag) {
+				hasTags = false
+				break
+			}
+		}
+
+		if hasTags {
+			matches = append(matches, image)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, errors.New("No image matches the base_image_filter")
+	}
+
+	if len(matches) > 1 && !filter.MostRecent {
+		return nil, fmt.Errorf("%d images match the base_image_filter, narrow it down or set most_recent", len(matches))
+	}
+
+	mostRecent := matches[0]
+	for _, image := range matches[1:] {
+		if imageCreateDate(image).After(imageCreateDate(mostRecent)) {
+			mostRecent = image
+		}
+	}
+
+	return mostRecent, nil
+}
+
+// tagNames returns the names of the tags applied to a template group or an instance.
+func tagNames(resource map[string]interface{}) []string {
+	var tags []string
+
+	references, _ := resource["tagReferences"].([]interface{})
+	for _, val := range references {
+		name, ok := lookupOptionValue(val, "tag", "name")
+		if ok {
+			tags = append(tags, fmt.Sprintf("%v", name))
+		}
+	}
+
+	return tags
+}
+
+// imageDatacenterNames returns the names of the datacenters a template group is available in.
+func imageDatacenterNames(image map[string]interface{}) []string {
+	var names []string
+
+	datacenters, _ := image["datacenters"].([]interface{})
+	for _, val := range datacenters {
+		name, ok := lookupOptionValue(val, "name")
+		if ok {
+			names = append(names, fmt.Sprintf("%v", name))
+		}
+	}
+
+	return names
+}
+
+// imageCreateDate returns the time a template group was created, or the zero time if it is unknown.
+func imageCreateDate(image map[string]interface{}) time.Time {
+	createDate, _ := image["createDate"].(string)
+	created, err := time.Parse(time.RFC3339, createDate)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return created
+}
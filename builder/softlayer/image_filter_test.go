@@ -0,0 +1,98 @@
+package softlayer
+
+import (
+	"testing"
+)
+
+func testImage(id string, name string, createDate string, datacenters []string, tags []string) map[string]interface{} {
+	var datacenterList []interface{}
+	for _, datacenter := range datacenters {
+		datacenterList = append(datacenterList, map[string]interface{}{"name": datacenter})
+	}
+
+	var tagReferences []interface{}
+	for _, tag := range tags {
+		tagReferences = append(tagReferences, map[string]interface{}{
+			"tag": map[string]interface{}{"name": tag},
+		})
+	}
+
+	return map[string]interface{}{
+		"globalIdentifier": id,
+		"name":             name,
+		"createDate":       createDate,
+		"datacenters":      datacenterList,
+		"tagReferences":    tagReferences,
+	}
+}
+
+func testImages() []interface{} {
+	return []interface{}{
+		testImage("a", "golden-centos-1", "2015-06-01T10:00:00-06:00", []string{"ams01"}, []string{"golden", "centos"}),
+		testImage("b", "golden-centos-3", "2015-06-03T10:00:00-06:00", []string{"ams01", "dal10"}, []string{"golden", "centos"}),
+		testImage("c", "golden-centos-2", "2015-06-02T10:00:00-06:00", []string{"dal10"}, []string{"centos"}),
+		testImage("d", "golden-ubuntu-1", "2015-06-04T10:00:00-06:00", []string{"ams01"}, []string{"golden", "ubuntu"}),
+	}
+}
+
+func TestImageFilter_MostRecent(t *testing.T) {
+	image, err := findMatchingImage(testImages(), BaseImageFilterConfig{
+		Name:       "^golden-centos-",
+		MostRecent: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if image["globalIdentifier"] != "b" {
+		t.Fatalf("Expected image 'b' but got '%v'", image["globalIdentifier"])
+	}
+}
+
+func TestImageFilter_TagsAndDatacenter(t *testing.T) {
+	image, err := findMatchingImage(testImages(), BaseImageFilterConfig{
+		Tags:       []string{"golden", "centos"},
+		Datacenter: "ams01",
+		MostRecent: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if image["globalIdentifier"] != "b" {
+		t.Fatalf("Expected image 'b' but got '%v'", image["globalIdentifier"])
+	}
+
+	image, err = findMatchingImage(testImages(), BaseImageFilterConfig{
+		Tags:       []string{"centos"},
+		Datacenter: "dal10",
+		Name:       "-2$",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if image["globalIdentifier"] != "c" {
+		t.Fatalf("Expected image 'c' but got '%v'", image["globalIdentifier"])
+	}
+}
+
+func TestImageFilter_Ambiguous(t *testing.T) {
+	_, err := findMatchingImage(testImages(), BaseImageFilterConfig{
+		Tags: []string{"golden"},
+	})
+	if err == nil {
+		t.Fatal("Expected an error when several images match without most_recent")
+	}
+}
+
+func TestImageFilter_NoMatch(t *testing.T) {
+	_, err := findMatchingImage(testImages(), BaseImageFilterConfig{
+		Tags:       []string{"golden"},
+		Datacenter: "fra02",
+		MostRecent: true,
+	})
+	if err == nil {
+		t.Fatal("Expected an error when no image matches")
+	}
+}
@@ -0,0 +1,124 @@
+package softlayer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImageRetentionConfig prunes the older images produced by the same template.
+type ImageRetentionConfig struct {
+	KeepLast int    `mapstructure:"keep_last"`
+	MaxAge   string `mapstructure:"max_age"`
+
+	// The images the policy applies to
+	Tag        string `mapstructure:"tag"`
+	NamePrefix string `mapstructure:"name_prefix"`
+
+	DryRun bool `mapstructure:"dry_run"`
+}
+
+// IsSet reports whether any of the options were configured.
+func (self *ImageRetentionConfig) IsSet() bool {
+	return *self != ImageRetentionConfig{}
+}
+
+// Prepare validates the configuration.
+func (self *ImageRetentionConfig) Prepare() []error {
+	var errs []error
+
+	if self.KeepLast < 0 {
+		errs = append(errs, errors.New("image_retention.keep_last must be a positive number"))
+	}
+
+	if self.KeepLast == 0 && self.MaxAge == "" {
+		errs = append(errs, errors.New("image_retention must specify keep_last, max_age or both"))
+	}
+
+	if self.MaxAge != "" {
+		if maxAge, err := time.ParseDuration(self.MaxAge); err != nil {
+			errs = append(errs, fmt.Errorf("Failed parsing image_retention.max_age: %s", err))
+		} else if maxAge <= 0 {
+			errs = append(errs, errors.New("image_retention.max_age must be a positive duration"))
+		}
+	}
+
+	if self.Tag == "" && self.NamePrefix == "" {
+		errs = append(errs, errors.New("image_retention must specify a tag or a name_prefix to match the images"))
+	}
+
+	return errs
+}
+
+// selectImagesToPrune returns the images, out of a list of template groups, the retention policy removes.
+// The image with the keepId global identifier is the one just built: it is never pruned, and counts as
+// the most recent image kept when it matches the policy. The images with the excludeIds global identifiers,
+// e.g. the base image of the build, are left out of the policy. So are the images without a known creation
+// date, their age can't be told.
+func selectImagesToPrune(images []interface{}, retention ImageRetentionConfig, now time.Time, keepId string, excludeIds []string) []map[string]interface{} {
+	var maxAge time.Duration
+	if retention.MaxAge != "" {
+		maxAge, _ = time.ParseDuration(retention.MaxAge)
+	}
+
+	kept := 0
+	var matches []map[string]interface{}
+	for _, val := range images {
+		image, ok := val.(map[string]interface{})
+		if !ok || image["globalIdentifier"] == nil {
+			continue
+		}
+
+		imageId, _ := image["globalIdentifier"].(string)
+		if containsString(excludeIds, imageId) {
+			continue
+		}
+
+		imageName, _ := image["name"].(string)
+		if retention.NamePrefix != "" && !strings.HasPrefix(imageName, retention.NamePrefix) {
+			continue
+		}
+
+		if retention.Tag != "" && !containsString(tagNames(image), retention.Tag) {
+			continue
+		}
+
+		if imageId == keepId {
+			kept = 1
+			continue
+		}
+
+		if imageCreateDate(image).IsZero() {
+			log.Printf("Not applying the image retention to image (%s), its creation date is unknown", imageId)
+			continue
+		}
+
+		matches = append(matches, image)
+	}
+
+	sort.Stable(imagesByAge(matches))
+
+	var pruned []map[string]interface{}
+	for i, image := range matches {
+		tooMany := retention.KeepLast > 0 && i+kept >= retention.KeepLast
+		tooOld := maxAge > 0 && now.Sub(imageCreateDate(image)) > maxAge
+
+		if tooMany || tooOld {
+			pruned = append(pruned, image)
+		}
+	}
+
+	return pruned
+}
+
+// imagesByAge sorts template groups from the most recent to the oldest.
+type imagesByAge []map[string]interface{}
+
+func (self imagesByAge) Len() int      { return len(self) }
+func (self imagesByAge) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+func (self imagesByAge) Less(i, j int) bool {
+	return imageCreateDate(self[i]).After(imageCreateDate(self[j]))
+}
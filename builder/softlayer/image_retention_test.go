@@ -0,0 +1,109 @@
+package softlayer
+
+import (
+	"testing"
+	"time"
+)
+
+func testRetentionImages() []interface{} {
+	tagged := []interface{}{
+		map[string]interface{}{"tag": map[string]interface{}{"name": "nightly"}},
+	}
+
+	return []interface{}{
+		map[string]interface{}{"id": 1., "globalIdentifier": "a", "name": "centos-1", "createDate": "2016-01-01T00:00:00-06:00", "tagReferences": tagged},
+		map[string]interface{}{"id": 2., "globalIdentifier": "b", "name": "centos-2", "createDate": "2016-01-02T00:00:00-06:00", "tagReferences": tagged},
+		map[string]interface{}{"id": 3., "globalIdentifier": "c", "name": "centos-3", "createDate": "2016-01-03T00:00:00-06:00", "tagReferences": tagged},
+		map[string]interface{}{"id": 4., "globalIdentifier": "d", "name": "centos-4", "createDate": "2016-01-04T00:00:00-06:00", "tagReferences": tagged},
+		map[string]interface{}{"id": 5., "globalIdentifier": "e", "name": "ubuntu-1", "createDate": "2016-01-01T00:00:00-06:00"},
+	}
+}
+
+func prunedIds(images []map[string]interface{}) []string {
+	var ids []string
+	for _, image := range images {
+		ids = append(ids, image["globalIdentifier"].(string))
+	}
+
+	return ids
+}
+
+func TestImageRetention_KeepLast(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-01-05T00:00:00-06:00")
+	retention := ImageRetentionConfig{KeepLast: 2, NamePrefix: "centos-"}
+
+	// The new image "d" counts as one of the images kept
+	pruned := prunedIds(selectImagesToPrune(testRetentionImages(), retention, now, "d", nil))
+	if len(pruned) != 2 || pruned[0] != "b" || pruned[1] != "a" {
+		t.Fatalf("Expected to prune b and a but got: %v", pruned)
+	}
+
+	retention = ImageRetentionConfig{KeepLast: 1, Tag: "nightly"}
+	pruned = prunedIds(selectImagesToPrune(testRetentionImages(), retention, now, "d", nil))
+	if len(pruned) != 3 {
+		t.Fatalf("Expected to prune every tagged image but the new one but got: %v", pruned)
+	}
+}
+
+func TestImageRetention_MaxAge(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-01-05T00:00:00-06:00")
+	retention := ImageRetentionConfig{MaxAge: "60h", NamePrefix: "centos-"}
+
+	pruned := prunedIds(selectImagesToPrune(testRetentionImages(), retention, now, "d", nil))
+	if len(pruned) != 2 || pruned[0] != "b" || pruned[1] != "a" {
+		t.Fatalf("Expected to prune b and a but got: %v", pruned)
+	}
+
+	retention = ImageRetentionConfig{MaxAge: "240h", NamePrefix: "centos-"}
+	if pruned := selectImagesToPrune(testRetentionImages(), retention, now, "d", nil); len(pruned) != 0 {
+		t.Fatalf("Expected to keep every image but got: %v", prunedIds(pruned))
+	}
+}
+
+func TestImageRetention_Exclude(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-01-05T00:00:00-06:00")
+	retention := ImageRetentionConfig{KeepLast: 2, NamePrefix: "centos-"}
+
+	// The excluded base image "c" is neither pruned nor counted as kept
+	pruned := prunedIds(selectImagesToPrune(testRetentionImages(), retention, now, "d", []string{"c"}))
+	if len(pruned) != 1 || pruned[0] != "a" {
+		t.Fatalf("Expected to prune a but got: %v", pruned)
+	}
+
+	if pruned := selectImagesToPrune(testRetentionImages(), retention, now, "d", []string{"c", "b"}); len(pruned) != 0 {
+		t.Fatalf("Expected to keep every image but got: %v", prunedIds(pruned))
+	}
+}
+
+func TestImageRetention_UnknownCreateDate(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-01-05T00:00:00-06:00")
+	retention := ImageRetentionConfig{KeepLast: 1, MaxAge: "60h", NamePrefix: "centos-"}
+
+	images := append(testRetentionImages(),
+		map[string]interface{}{"id": 6., "globalIdentifier": "f", "name": "centos-5"},
+		map[string]interface{}{"id": 7., "globalIdentifier": "g", "name": "centos-6", "createDate": "yesterday"})
+
+	// The images of unknown age are neither pruned nor counted as kept
+	pruned := prunedIds(selectImagesToPrune(images, retention, now, "d", nil))
+	if len(pruned) != 3 || pruned[0] != "c" || pruned[1] != "b" || pruned[2] != "a" {
+		t.Fatalf("Expected to prune c, b and a but got: %v", pruned)
+	}
+}
+
+func TestImageRetention_NewImageOutsidePolicy(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-01-05T00:00:00-06:00")
+	retention := ImageRetentionConfig{KeepLast: 1, NamePrefix: "ubuntu-"}
+
+	// The new image "d" doesn't match the policy, so it doesn't count as the ubuntu image kept
+	if pruned := selectImagesToPrune(testRetentionImages(), retention, now, "d", nil); len(pruned) != 0 {
+		t.Fatalf("Expected to keep every image but got: %v", prunedIds(pruned))
+	}
+
+	// A new image matching the policy does
+	images := append(testRetentionImages(),
+		map[string]interface{}{"id": 8., "globalIdentifier": "h", "name": "ubuntu-0", "createDate": "2015-12-31T00:00:00-06:00"})
+	pruned := prunedIds(selectImagesToPrune(images, retention, now, "e", nil))
+	if len(pruned) != 1 || pruned[0] != "h" {
+		t.Fatalf("Expected to prune h but got: %v", pruned)
+	}
+}
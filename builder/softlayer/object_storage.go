@@ -0,0 +1,98 @@
+package softlayer
+
+import (
+	"fmt"
+)
+
+// Object storage types
+const OBJECT_STORAGE_ICOS = "icos"
+const OBJECT_STORAGE_SWIFT = "swift"
+
+// ObjectStorageConfig points at an image file in IBM Cloud Object Storage or in Swift object storage.
+type ObjectStorageConfig struct {
+	Type       string `mapstructure:"type"`
+	Endpoint   string `mapstructure:"endpoint"`
+	Bucket     string `mapstructure:"bucket"`
+	ObjectName string `mapstructure:"object_name"`
+
+	// IBM Cloud Object Storage is accessed with an IBM Cloud API key,
+	// Swift with the object storage account of the SoftLayer account.
+	IBMApiKey    string `mapstructure:"ibm_api_key"`
+	SwiftAccount string `mapstructure:"swift_account"`
+}
+
+// IsSet reports whether any of the options were configured.
+func (self *ObjectStorageConfig) IsSet() bool {
+	return *self != ObjectStorageConfig{}
+}
+
+// Prepare assigns the defaults and validates the configuration, prefix is the
+// name of the configuration block used in error messages.
+func (self *ObjectStorageConfig) Prepare(prefix string) []error {
+	var errs []error
+
+	if self.Type == "" {
+		self.Type = OBJECT_STORAGE_ICOS
+	}
+
+	if self.Bucket == "" {
+		errs = append(errs, fmt.Errorf("%s.bucket must be specified", prefix))
+	}
+
+	if self.Endpoint == "" {
+		errs = append(errs, fmt.Errorf("%s.endpoint must be specified", prefix))
+	}
+
+	if self.ObjectName == "" {
+		errs = append(errs, fmt.Errorf("%s.object_name must be specified", prefix))
+	}
+
+	switch self.Type {
+	case OBJECT_STORAGE_ICOS:
+		if self.IBMApiKey == "" {
+			errs = append(errs, fmt.Errorf("%s.ibm_api_key must be specified for IBM Cloud Object Storage", prefix))
+		}
+	case OBJECT_STORAGE_SWIFT:
+		if self.SwiftAccount == "" {
+			errs = append(errs, fmt.Errorf("%s.swift_account must be specified for Swift object storage", prefix))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("Unknown %s.type '%s'. Must be one of 'icos' (the default) or 'swift'.", prefix, self.Type))
+	}
+
+	return errs
+}
+
+// Uri returns the object location the way the SoftLayer API expects it.
+func (self *ObjectStorageConfig) Uri() string {
+	if self.Type == OBJECT_STORAGE_SWIFT {
+		return fmt.Sprintf("swift://%s@%s/%s/%s", self.SwiftAccount, self.Endpoint, self.Bucket, self.ObjectName)
+	}
+
+	return fmt.Sprintf("cos://%s/%s/%s", self.Endpoint, self.Bucket, self.ObjectName)
+}
+
+// BaseImageSourceConfig points at an image file to import and use as the base image.
+type BaseImageSourceConfig struct {
+	ObjectStorageConfig `mapstructure:",squash"`
+
+	// The operating system of the image, as a SoftLayer reference code (e.g. "CENTOS_7_64")
+	OsCode           string `mapstructure:"os_code"`
+	DeleteAfterBuild bool   `mapstructure:"delete_after_build"`
+}
+
+// IsSet reports whether any of the options were configured.
+func (self *BaseImageSourceConfig) IsSet() bool {
+	return *self != BaseImageSourceConfig{}
+}
+
+// Prepare assigns the defaults and validates the configuration.
+func (self *BaseImageSourceConfig) Prepare() []error {
+	errs := self.ObjectStorageConfig.Prepare("base_image_source")
+
+	if self.OsCode == "" {
+		errs = append(errs, fmt.Errorf("base_image_source.os_code must be specified"))
+	}
+
+	return errs
+}
@@ -0,0 +1,123 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// Ways to handle the instance of a failed build
+const ON_ERROR_DESTROY = "destroy"
+const ON_ERROR_KEEP = "keep"
+const ON_ERROR_ASK = "ask"
+
+// onErrorMode returns how to handle the instance of a failed build: on_error if it is set, otherwise
+// packer's -on-error flag, otherwise asking in debug mode and destroying it by default.
+func onErrorMode(config Config) string {
+	if config.OnError != "" {
+		return config.OnError
+	}
+
+	switch config.PackerOnError {
+	case "abort":
+		return ON_ERROR_KEEP
+	case "ask":
+		return ON_ERROR_ASK
+	case "cleanup":
+		return ON_ERROR_DESTROY
+	}
+
+	if config.PackerDebug {
+		return ON_ERROR_ASK
+	}
+
+	return ON_ERROR_DESTROY
+}
+
+// keepInstanceOnError tells the cleanups whether to keep the instance and the resources needed to
+// debug it. The decision is made once per build and kept in the state.
+func keepInstanceOnError(state multistep.StateBag) bool {
+	if keep, ok := state.GetOk("keep_instance"); ok {
+		return keep.(bool)
+	}
+
+	keep := false
+
+	// Only failed builds keep the instance, cancelled builds clean up
+	_, failed := state.GetOk("error")
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	if failed && !cancelled {
+		config := state.Get("config").(Config)
+		ui := state.Get("ui").(packer.Ui)
+
+		switch onErrorMode(config) {
+		case ON_ERROR_KEEP:
+			keep = true
+		case ON_ERROR_ASK:
+			keep = askKeepInstance(ui)
+		}
+	}
+
+	state.Put("keep_instance", keep)
+
+	return keep
+}
+
+func askKeepInstance(ui packer.Ui) bool {
+	for {
+		answer, err := ui.Ask("The build failed. [k] Keep the instance for debugging, [d] Destroy it")
+		if err != nil {
+			log.Printf("Error asking whether to keep the instance: %s", err)
+			return false
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "k", "keep":
+			return true
+		case "d", "destroy":
+			return false
+		}
+	}
+}
+
+// reportKeptInstance prints how to connect to the kept instance of a failed build.
+func reportKeptInstance(state multistep.StateBag, instanceId string) {
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say(fmt.Sprintf("Keeping the instance (%s) for debugging. Please delete it manually once done.", instanceId))
+
+	if ipAddress, err := commHost(state); err == nil {
+		ui.Message(fmt.Sprintf("IP address: %s", ipAddress))
+	} else {
+		log.Printf("Error getting the IP address of the kept instance: %s", err)
+	}
+
+	if config.Comm.Type != "ssh" {
+		return
+	}
+
+	privateKeyFile := config.Comm.SSHPrivateKey
+	if privateKeyFile == "" {
+		privateKeyFile = config.TemporaryKeyFile
+	}
+
+	// Save the temporary key, unless it already was
+	if privateKeyFile == "" {
+		privateKey, ok := state.GetOk("ssh_private_key")
+		if !ok {
+			return
+		}
+
+		privateKeyFile = fmt.Sprintf("%s.pem", config.InstanceName)
+		if err := ioutil.WriteFile(privateKeyFile, []byte(privateKey.(string)), 0600); err != nil {
+			ui.Error(fmt.Sprintf("Error saving the temporary private key: %s", err))
+			return
+		}
+	}
+
+	ui.Message(fmt.Sprintf("Private key: %s (user %s)", privateKeyFile, config.Comm.SSHUsername))
+}
@@ -0,0 +1,93 @@
+package softlayer
+
+import (
+	"errors"
+	"github.com/mitchellh/multistep"
+	"testing"
+)
+
+// testAskUi answers every question with the next of its answers.
+type testAskUi struct {
+	answers []string
+	asked   int
+}
+
+func (self *testAskUi) Ask(query string) (string, error) {
+	if self.asked >= len(self.answers) {
+		return "", errors.New("no more answers")
+	}
+
+	self.asked++
+	return self.answers[self.asked-1], nil
+}
+
+func (self *testAskUi) Say(message string)                      {}
+func (self *testAskUi) Message(message string)                  {}
+func (self *testAskUi) Error(message string)                    {}
+func (self *testAskUi) Machine(category string, args ...string) {}
+
+func testOnErrorState(config Config, ui *testAskUi, failed bool) multistep.StateBag {
+	state := new(multistep.BasicStateBag)
+	state.Put("config", config)
+	state.Put("ui", ui)
+	if failed {
+		state.Put("error", errors.New("provisioning failed"))
+	}
+
+	return state
+}
+
+func TestOnError_Mode(t *testing.T) {
+	modes := []struct {
+		config Config
+		mode   string
+	}{
+		{Config{}, ON_ERROR_DESTROY},
+		{Config{OnError: ON_ERROR_KEEP}, ON_ERROR_KEEP},
+		{Config{PackerOnError: "abort"}, ON_ERROR_KEEP},
+		{Config{PackerOnError: "ask"}, ON_ERROR_ASK},
+		{Config{OnError: ON_ERROR_DESTROY, PackerOnError: "abort"}, ON_ERROR_DESTROY},
+	}
+
+	for _, m := range modes {
+		if mode := onErrorMode(m.config); mode != m.mode {
+			t.Fatalf("Expected on_error '%s' for %+v but got '%s'", m.mode, m.config, mode)
+		}
+	}
+
+	config := Config{}
+	config.PackerDebug = true
+	if mode := onErrorMode(config); mode != ON_ERROR_ASK {
+		t.Fatalf("Expected to ask in debug mode but got '%s'", mode)
+	}
+}
+
+func TestOnError_KeepInstance(t *testing.T) {
+	keepConfig := Config{OnError: ON_ERROR_KEEP}
+
+	if keepInstanceOnError(testOnErrorState(keepConfig, &testAskUi{}, false)) {
+		t.Fatal("Expected successful builds to destroy the instance")
+	}
+
+	state := testOnErrorState(keepConfig, &testAskUi{}, true)
+	state.Put(multistep.StateCancelled, true)
+	if keepInstanceOnError(state) {
+		t.Fatal("Expected cancelled builds to destroy the instance")
+	}
+
+	if !keepInstanceOnError(testOnErrorState(keepConfig, &testAskUi{}, true)) {
+		t.Fatal("Expected failed builds to keep the instance")
+	}
+
+	// The question is asked once and the answer shared by the cleanups
+	ui := &testAskUi{answers: []string{"maybe", "k"}}
+	state = testOnErrorState(Config{OnError: ON_ERROR_ASK}, ui, true)
+	if !keepInstanceOnError(state) || !keepInstanceOnError(state) || ui.asked != 2 {
+		t.Fatalf("Expected to keep the instance after asking twice, asked %d times", ui.asked)
+	}
+
+	ui = &testAskUi{answers: []string{"d"}}
+	if keepInstanceOnError(testOnErrorState(Config{OnError: ON_ERROR_ASK}, ui, true)) {
+		t.Fatal("Expected to destroy the instance")
+	}
+}
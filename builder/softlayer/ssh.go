@@ -1,16 +1,39 @@
 package softlayer
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/helper/communicator"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io/ioutil"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
 )
 
 func commHost(state multistep.StateBag) (string, error) {
 	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
 	instance := state.Get("instance_data").(map[string]interface{})
 	instanceId := instance["globalIdentifier"].(string)
+
+	// Behind a bastion, or without a public interface, the instance is reached on the private network
+	if config.InstancePrivateNetworkOnly || config.Comm.SSHBastionHost != "" || config.SSHBastionLookup.IsSet() {
+		ipAddress, err := client.getInstanceBackendIp(instanceId)
+		if err != nil {
+			return "", fmt.Errorf("Failed to fetch the backend IP address for instance '%s': %s", instanceId, err)
+		}
+
+		return ipAddress, nil
+	}
+
 	ipAddress, err := client.getInstancePublicIp(instanceId)
 	if err != nil {
 		err := errors.New(fmt.Sprintf("Failed to fetch Public IP address for instance '%s'", instanceId))
@@ -22,17 +45,164 @@ func commHost(state multistep.StateBag) (string, error) {
 
 func sshConfig(state multistep.StateBag) (*ssh.ClientConfig, error) {
 	config := state.Get("config").(Config)
-	privateKey := state.Get("ssh_private_key").(string)
 
-	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
-	if err != nil {
-		return nil, fmt.Errorf("Error setting up SSH config: %s", err)
+	var auth []ssh.AuthMethod
+	if privateKey, ok := state.GetOk("ssh_private_key"); ok {
+		signer, err := parsePrivateKey(privateKey.(string), config.SSHPrivateKeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("Error setting up SSH config: %s", err)
+		}
+
+		// Offer the certificate before the bare key
+		if config.SSHCertificateFile != "" {
+			certSigner, err := certificateSigner(config.SSHCertificateFile, signer)
+			if err != nil {
+				return nil, fmt.Errorf("Error setting up SSH config: %s", err)
+			}
+
+			auth = append(auth, ssh.PublicKeys(certSigner))
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	// The agent connection is opened once per build, see stepConnectSshAgent
+	if config.SSHAgentAuth {
+		sshAgent, ok := state.GetOk("ssh_agent")
+		if !ok {
+			return nil, errors.New("Error setting up SSH config: not connected to the ssh agent")
+		}
+
+		auth = append(auth, ssh.PublicKeysCallback(sshAgent.(agent.Agent).Signers))
+	}
+
+	if config.SSHUseProvisionedPassword {
+		password := state.Get("instance_password").(string)
+		auth = append(auth,
+			ssh.Password(password),
+			ssh.KeyboardInteractive(passwordKeyboardInteractive(password)))
 	}
 
 	return &ssh.ClientConfig{
 		User: config.Comm.SSHUsername,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
+		Auth: auth,
+
+		HostKeyCallback: hostKeyVerifierFor(state).Check,
+	}, nil
+}
+
+// hostKeyVerifier checks the host key of the instance. The key must have the configured fingerprint if
+// there is one, otherwise the first key seen is trusted and pinned for the reconnections of the build.
+type hostKeyVerifier struct {
+	fingerprint string
+
+	mutex  sync.Mutex
+	pinned ssh.PublicKey
+}
+
+// hostKeyVerifierFor returns the verifier of the build, which is kept in the state to outlive the ssh configs.
+func hostKeyVerifierFor(state multistep.StateBag) *hostKeyVerifier {
+	if verifier, ok := state.GetOk("ssh_host_key_verifier"); ok {
+		return verifier.(*hostKeyVerifier)
+	}
+
+	config := state.Get("config").(Config)
+	verifier := &hostKeyVerifier{fingerprint: config.SSHHostKeyFingerprint}
+	state.Put("ssh_host_key_verifier", verifier)
+
+	return verifier
+}
+
+func (self *hostKeyVerifier) Check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.pinned != nil {
+		if !bytes.Equal(key.Marshal(), self.pinned.Marshal()) {
+			return fmt.Errorf("The host key of %s changed during the build: expected %s but got %s",
+				hostname, ssh.FingerprintSHA256(self.pinned), ssh.FingerprintSHA256(key))
+		}
+
+		return nil
+	}
+
+	if self.fingerprint != "" && !matchesFingerprint(key, self.fingerprint) {
+		return fmt.Errorf("The host key of %s doesn't match ssh_host_key_fingerprint: expected %s but got %s",
+			hostname, self.fingerprint, ssh.FingerprintSHA256(key))
+	}
+
+	log.Printf("Pinning the host key of %s (%s)", hostname, ssh.FingerprintSHA256(key))
+	self.pinned = key
+
+	return nil
+}
+
+// matchesFingerprint compares a key with a fingerprint, either a SHA256 one ("SHA256:<base64>")
+// or a legacy MD5 one ("MD5:<hex>" or just "<hex>").
+func matchesFingerprint(key ssh.PublicKey, fingerprint string) bool {
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		return ssh.FingerprintSHA256(key) == fingerprint
+	}
+
+	return strings.EqualFold(ssh.FingerprintLegacyMD5(key), strings.TrimPrefix(fingerprint, "MD5:"))
+}
+
+// isValidFingerprint checks the format of a fingerprint accepted by matchesFingerprint.
+func isValidFingerprint(fingerprint string) bool {
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(fingerprint, "SHA256:"))
+		return err == nil && len(decoded) == sha256.Size
+	}
+
+	return md5FingerprintPattern.MatchString(strings.TrimPrefix(fingerprint, "MD5:"))
+}
+
+var md5FingerprintPattern = regexp.MustCompile(`^[0-9a-fA-F]{2}(:[0-9a-fA-F]{2}){15}$`)
+
+// certificateSigner reads an OpenSSH certificate issued for the key of the signer.
+func certificateSigner(certificateFile string, signer ssh.Signer) (ssh.Signer, error) {
+	certificateBytes, err := ioutil.ReadFile(certificateFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading ssh_certificate_file: %s", err)
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(certificateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing ssh_certificate_file: %s", err)
+	}
+
+	certificate, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("ssh_certificate_file doesn't contain a certificate")
+	}
+
+	return ssh.NewCertSigner(certificate, signer)
+}
+
+// passwordKeyboardInteractive answers every keyboard-interactive question with the password,
+// for servers that only allow that method.
+func passwordKeyboardInteractive(password string) ssh.KeyboardInteractiveChallenge {
+	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range questions {
+			answers[i] = password
+		}
+
+		return answers, nil
+	}
+}
+
+func winrmConfig(state multistep.StateBag) (*communicator.WinRMConfig, error) {
+	config := state.Get("config").(Config)
+
+	// Without a configured password, use the one the instance was provisioned with
+	password := config.Comm.WinRMPassword
+	if password == "" {
+		password = state.Get("instance_password").(string)
+	}
+
+	return &communicator.WinRMConfig{
+		Username: config.Comm.WinRMUser,
+		Password: password,
 	}, nil
 }
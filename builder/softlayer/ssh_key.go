@@ -0,0 +1,191 @@
+package softlayer
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"strings"
+)
+
+// Temporary key types
+const TEMPORARY_KEY_TYPE_RSA = "rsa"
+const TEMPORARY_KEY_TYPE_ECDSA = "ecdsa"
+const TEMPORARY_KEY_TYPE_ED25519 = "ed25519"
+
+// validateTemporaryKey checks that SoftLayer accepts keys of the given type and size.
+func validateTemporaryKey(keyType string, bits int) error {
+	switch keyType {
+	case TEMPORARY_KEY_TYPE_RSA:
+		if bits < 2048 || bits > 8192 {
+			return fmt.Errorf("Invalid temporary_key_bits '%d'. RSA keys must be between 2048 and 8192 bits long.", bits)
+		}
+	case TEMPORARY_KEY_TYPE_ECDSA:
+		if ecdsaCurve(bits) == nil {
+			return fmt.Errorf("Invalid temporary_key_bits '%d'. ECDSA keys must be 256, 384 or 521 bits long.", bits)
+		}
+	case TEMPORARY_KEY_TYPE_ED25519:
+		if bits != 0 && bits != 256 {
+			return fmt.Errorf("Invalid temporary_key_bits '%d'. Ed25519 keys are always 256 bits long.", bits)
+		}
+	default:
+		return fmt.Errorf("Unknown temporary_key_type '%s'. Must be one of 'rsa' (the default), 'ecdsa' or 'ed25519'.", keyType)
+	}
+
+	return nil
+}
+
+// generateTemporaryKey generates a key pair, it returns the PEM encoded private key and
+// the public key in the authorized_keys format.
+func generateTemporaryKey(keyType string, bits int) (string, string, error) {
+	var privateKey interface{}
+	var block *pem.Block
+
+	switch keyType {
+	case TEMPORARY_KEY_TYPE_RSA:
+		rsaKey, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return "", "", err
+		}
+
+		privateKey = rsaKey
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}
+	case TEMPORARY_KEY_TYPE_ECDSA:
+		ecdsaKey, err := ecdsa.GenerateKey(ecdsaCurve(bits), rand.Reader)
+		if err != nil {
+			return "", "", err
+		}
+
+		der, err := x509.MarshalECPrivateKey(ecdsaKey)
+		if err != nil {
+			return "", "", err
+		}
+
+		privateKey = ecdsaKey
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	case TEMPORARY_KEY_TYPE_ED25519:
+		_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", "", err
+		}
+
+		// Ed25519 keys have no dedicated PEM format
+		der, err := x509.MarshalPKCS8PrivateKey(ed25519Key)
+		if err != nil {
+			return "", "", err
+		}
+
+		privateKey = ed25519Key
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		return "", "", fmt.Errorf("Unknown key type '%s'", keyType)
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	return string(pem.EncodeToMemory(block)), publicKey, nil
+}
+
+func ecdsaCurve(bits int) elliptic.Curve {
+	switch bits {
+	case 256:
+		return elliptic.P256()
+	case 384:
+		return elliptic.P384()
+	case 521:
+		return elliptic.P521()
+	}
+
+	return nil
+}
+
+// parsePrivateKey parses a PEM encoded private key, decrypting it with the passphrase if one is given.
+func parsePrivateKey(privateKey string, passphrase string) (ssh.Signer, error) {
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return nil, errors.New("the private key is encrypted, please set ssh_private_key_passphrase")
+	}
+
+	return signer, err
+}
+
+// findAccountSshKeys returns the ids of the account keys, out of the keys listed by getSshKeys, selected by id or
+// by label. One of them must be the public key the builder connects with.
+func findAccountSshKeys(keys []interface{}, ids []int64, labels []string, localKey ssh.PublicKey) ([]int64, error) {
+	var selected []map[string]interface{}
+	var selectedIds []int64
+	selectKey := func(key map[string]interface{}) {
+		keyId := int64(key["id"].(float64))
+		for _, id := range selectedIds {
+			if id == keyId {
+				return
+			}
+		}
+
+		selected = append(selected, key)
+		selectedIds = append(selectedIds, keyId)
+	}
+
+	for _, id := range ids {
+		key := findAccountSshKey(keys, "id", float64(id))
+		if key == nil {
+			return nil, fmt.Errorf("Could not find an ssh key with id '%d' in the account", id)
+		}
+		selectKey(key)
+	}
+
+	for _, label := range labels {
+		key := findAccountSshKey(keys, "label", label)
+		if key == nil {
+			return nil, fmt.Errorf("Could not find an ssh key labeled '%s' in the account", label)
+		}
+		selectKey(key)
+	}
+
+	fingerprint := ssh.FingerprintLegacyMD5(localKey)
+
+	var fingerprints []string
+	for _, key := range selected {
+		keyFingerprint, _ := key["fingerprint"].(string)
+		if keyFingerprint == "" {
+			// Compute the fingerprint when SoftLayer didn't report it
+			if publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(fmt.Sprintf("%v", key["key"]))); err == nil {
+				keyFingerprint = ssh.FingerprintLegacyMD5(publicKey)
+			}
+		}
+
+		if keyFingerprint == fingerprint {
+			return selectedIds, nil
+		}
+		fingerprints = append(fingerprints, keyFingerprint)
+	}
+
+	return nil, fmt.Errorf("The private key (fingerprint %s) matches none of the selected ssh keys (fingerprints %s)",
+		fingerprint, strings.Join(fingerprints, ", "))
+}
+
+func findAccountSshKey(keys []interface{}, field string, value interface{}) map[string]interface{} {
+	for _, val := range keys {
+		key, ok := val.(map[string]interface{})
+		if ok && key[field] == value {
+			return key
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package softlayer
+
+import (
+	"golang.org/x/crypto/ssh"
+	"strings"
+	"testing"
+)
+
+func TestSshKey_Generate(t *testing.T) {
+	keys := []struct {
+		keyType   string
+		bits      int
+		algorithm string
+	}{
+		{TEMPORARY_KEY_TYPE_RSA, 2048, "ssh-rsa"},
+		{TEMPORARY_KEY_TYPE_ECDSA, 384, "ecdsa-sha2-nistp384"},
+		{TEMPORARY_KEY_TYPE_ED25519, 0, "ssh-ed25519"},
+	}
+
+	for _, key := range keys {
+		privateKey, publicKey, err := generateTemporaryKey(key.keyType, key.bits)
+		if err != nil {
+			t.Fatalf("Unexpected error generating a %s key: %s", key.keyType, err)
+		}
+
+		if !strings.HasPrefix(publicKey, key.algorithm+" ") {
+			t.Fatalf("Expected a %s public key but got '%s'", key.algorithm, publicKey)
+		}
+
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+		if err != nil {
+			t.Fatalf("Unexpected error parsing the %s private key: %s", key.keyType, err)
+		}
+
+		if parsed := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))); parsed != publicKey {
+			t.Fatalf("The %s private key doesn't match the public key", key.keyType)
+		}
+	}
+}
+
+func TestSshKey_Validate(t *testing.T) {
+	valid := map[string]int{
+		TEMPORARY_KEY_TYPE_RSA:     4096,
+		TEMPORARY_KEY_TYPE_ECDSA:   521,
+		TEMPORARY_KEY_TYPE_ED25519: 0,
+	}
+	for keyType, bits := range valid {
+		if err := validateTemporaryKey(keyType, bits); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	invalid := map[string]int{
+		TEMPORARY_KEY_TYPE_RSA:     2014,
+		TEMPORARY_KEY_TYPE_ECDSA:   512,
+		TEMPORARY_KEY_TYPE_ED25519: 4096,
+		"dsa":                      1024,
+	}
+	for keyType, bits := range invalid {
+		if err := validateTemporaryKey(keyType, bits); err == nil {
+			t.Fatalf("Expected an error for a %d bits %s key", bits, keyType)
+		}
+	}
+}
+
+func TestSshKey_FindAccountSshKeys(t *testing.T) {
+	privateKey, publicKey, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_ED25519, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	_, otherPublicKey, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_ED25519, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	parsed, _, _, _, _ := ssh.ParseAuthorizedKey([]byte(publicKey))
+	signer, err := parsePrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	localKey := signer.PublicKey()
+	keys := []interface{}{
+		map[string]interface{}{"id": 1., "label": "provisioning", "fingerprint": ssh.FingerprintLegacyMD5(parsed)},
+		map[string]interface{}{"id": 2., "label": "security-team", "key": otherPublicKey},
+		map[string]interface{}{"id": 3., "label": "backup", "key": publicKey},
+	}
+
+	ids, err := findAccountSshKeys(keys, []int64{2}, []string{"provisioning", "security-team"}, localKey)
+	if err != nil || len(ids) != 2 || ids[0] != 2 || ids[1] != 1 {
+		t.Fatalf("Expected the keys 2 and 1 but got: %v, %v", ids, err)
+	}
+
+	// The fingerprint is computed from the key when it isn't reported
+	ids, err = findAccountSshKeys(keys, []int64{3}, nil, localKey)
+	if err != nil || len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("Expected the key 3 but got: %v, %v", ids, err)
+	}
+
+	if _, err := findAccountSshKeys(keys, []int64{2}, nil, localKey); err == nil {
+		t.Fatal("Expected an error for keys not matching the private key")
+	}
+
+	if _, err := findAccountSshKeys(keys, []int64{4}, nil, localKey); err == nil {
+		t.Fatal("Expected an error for an unknown key id")
+	}
+
+	if _, err := findAccountSshKeys(keys, nil, []string{"unknown"}, localKey); err == nil {
+		t.Fatal("Expected an error for an unknown key label")
+	}
+}
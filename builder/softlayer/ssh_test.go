@@ -0,0 +1,336 @@
+package softlayer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/mitchellh/multistep"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSshServer accepts the connections authenticated by the public key callback,
+// and returns the address it listens on and its host key.
+func testSshServer(t *testing.T, publicKeyCallback func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error)) (string, ssh.PublicKey) {
+	hostKey, _, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_ED25519, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	hostSigner, err := ssh.ParsePrivateKey([]byte(hostKey))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	serverConfig := &ssh.ServerConfig{PublicKeyCallback: publicKeyCallback}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				serverConn, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				defer serverConn.Close()
+
+				go ssh.DiscardRequests(requests)
+				for channel := range channels {
+					channel.Reject(ssh.Prohibited, "no channels in tests")
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), hostSigner.PublicKey()
+}
+
+// authorizedKeyCallback accepts a single public key.
+func authorizedKeyCallback(authorized ssh.PublicKey) func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+	return func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+			return nil, nil
+		}
+
+		return nil, ssh.ErrNoAuth
+	}
+}
+
+func testSshState(config Config, privateKey string) multistep.StateBag {
+	config.Comm.SSHUsername = "root"
+
+	state := new(multistep.BasicStateBag)
+	state.Put("config", config)
+	if privateKey != "" {
+		state.Put("ssh_private_key", privateKey)
+	}
+
+	return state
+}
+
+func testSshConnect(t *testing.T, address string, state multistep.StateBag) error {
+	clientConfig, err := sshConfig(state)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	client, err := ssh.Dial("tcp", address, clientConfig)
+	if err != nil {
+		return err
+	}
+
+	return client.Close()
+}
+
+func TestSshConfig_PrivateKey(t *testing.T) {
+	privateKey, _, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_ECDSA, 256)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	signer, _ := ssh.ParsePrivateKey([]byte(privateKey))
+	address, _ := testSshServer(t, authorizedKeyCallback(signer.PublicKey()))
+
+	if err := testSshConnect(t, address, testSshState(Config{}, privateKey)); err != nil {
+		t.Fatalf("Unexpected error connecting: %s", err)
+	}
+}
+
+func TestSshConfig_EncryptedPrivateKey(t *testing.T) {
+	privateKey, _, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_RSA, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	block, _ := pem.Decode([]byte(privateKey))
+	encryptedBlock, err := x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	encryptedKey := string(pem.EncodeToMemory(encryptedBlock))
+
+	signer, _ := ssh.ParsePrivateKey([]byte(privateKey))
+	address, _ := testSshServer(t, authorizedKeyCallback(signer.PublicKey()))
+
+	if _, err := sshConfig(testSshState(Config{}, encryptedKey)); err == nil {
+		t.Fatal("Expected an error for an encrypted key without passphrase")
+	}
+
+	config := Config{SSHPrivateKeyPassphrase: "secret"}
+	if err := testSshConnect(t, address, testSshState(config, encryptedKey)); err != nil {
+		t.Fatalf("Unexpected error connecting: %s", err)
+	}
+}
+
+func TestSshConfig_Certificate(t *testing.T) {
+	privateKey, _, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_ED25519, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	authorityKey, _, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_ED25519, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	signer, _ := ssh.ParsePrivateKey([]byte(privateKey))
+	authority, _ := ssh.ParsePrivateKey([]byte(authorityKey))
+
+	certificate := &ssh.Certificate{
+		Key:             signer.PublicKey(),
+		CertType:        ssh.UserCert,
+		KeyId:           "packer",
+		ValidPrincipals: []string{"root"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := certificate.SignCert(rand.Reader, authority); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	certificateFile := filepath.Join(t.TempDir(), "id_ed25519-cert.pub")
+	if err := ioutil.WriteFile(certificateFile, ssh.MarshalAuthorizedKey(certificate), 0600); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Only certificates issued by the authority are accepted
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(key ssh.PublicKey) bool {
+			return bytes.Equal(key.Marshal(), authority.PublicKey().Marshal())
+		},
+	}
+	address, _ := testSshServer(t, func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		if _, ok := key.(*ssh.Certificate); !ok {
+			return nil, ssh.ErrNoAuth
+		}
+
+		return checker.Authenticate(conn, key)
+	})
+
+	if err := testSshConnect(t, address, testSshState(Config{}, privateKey)); err == nil {
+		t.Fatal("Expected the bare key to be rejected")
+	}
+
+	config := Config{SSHCertificateFile: certificateFile}
+	if err := testSshConnect(t, address, testSshState(config, privateKey)); err != nil {
+		t.Fatalf("Unexpected error connecting: %s", err)
+	}
+}
+
+func TestSshConfig_Agent(t *testing.T) {
+	privateKey, _, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_ED25519, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	block, _ := pem.Decode([]byte(privateKey))
+	agentKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: agentKey}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	signer, _ := ssh.ParsePrivateKey([]byte(privateKey))
+	address, _ := testSshServer(t, authorizedKeyCallback(signer.PublicKey()))
+
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+	os.Setenv("SSH_AUTH_SOCK", socket)
+
+	config := Config{SSHAgentAuth: true}
+	state := testSshState(config, "")
+	state.Put("ui", &testAskUi{})
+
+	if _, err := sshConfig(state); err == nil {
+		t.Fatal("Expected an error before connecting to the agent")
+	}
+
+	step := new(stepConnectSshAgent)
+	if action := step.Run(state); action != multistep.ActionContinue {
+		t.Fatalf("Unexpected error connecting to the agent: %s", state.Get("error"))
+	}
+
+	// Every connection attempt shares the agent connection
+	for i := 0; i < 2; i++ {
+		if err := testSshConnect(t, address, state); err != nil {
+			t.Fatalf("Unexpected error connecting: %s", err)
+		}
+	}
+
+	step.Cleanup(state)
+	if err := testSshConnect(t, address, state); err == nil {
+		t.Fatal("Expected an error once the agent connection is closed")
+	}
+
+	os.Setenv("SSH_AUTH_SOCK", "")
+	state = testSshState(config, "")
+	state.Put("ui", &testAskUi{})
+	if action := new(stepConnectSshAgent).Run(state); action != multistep.ActionHalt {
+		t.Fatal("Expected an error without SSH_AUTH_SOCK")
+	}
+}
+
+func TestSshConfig_HostKeyFingerprint(t *testing.T) {
+	privateKey, _, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_ED25519, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	signer, _ := ssh.ParsePrivateKey([]byte(privateKey))
+	address, hostKey := testSshServer(t, authorizedKeyCallback(signer.PublicKey()))
+	_, otherHostKey := testSshServer(t, authorizedKeyCallback(signer.PublicKey()))
+
+	for _, fingerprint := range []string{ssh.FingerprintSHA256(hostKey), ssh.FingerprintLegacyMD5(hostKey)} {
+		config := Config{SSHHostKeyFingerprint: fingerprint}
+		if err := testSshConnect(t, address, testSshState(config, privateKey)); err != nil {
+			t.Fatalf("Unexpected error connecting with fingerprint %s: %s", fingerprint, err)
+		}
+	}
+
+	config := Config{SSHHostKeyFingerprint: ssh.FingerprintSHA256(otherHostKey)}
+	if err := testSshConnect(t, address, testSshState(config, privateKey)); err == nil {
+		t.Fatal("Expected an error for a host key not matching the fingerprint")
+	}
+}
+
+func TestSshConfig_HostKeyPinning(t *testing.T) {
+	privateKey, _, err := generateTemporaryKey(TEMPORARY_KEY_TYPE_ED25519, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	signer, _ := ssh.ParsePrivateKey([]byte(privateKey))
+	address, _ := testSshServer(t, authorizedKeyCallback(signer.PublicKey()))
+	otherAddress, _ := testSshServer(t, authorizedKeyCallback(signer.PublicKey()))
+
+	state := testSshState(Config{}, privateKey)
+	if err := testSshConnect(t, address, state); err != nil {
+		t.Fatalf("Unexpected error connecting: %s", err)
+	}
+
+	if err := testSshConnect(t, address, state); err != nil {
+		t.Fatalf("Unexpected error reconnecting: %s", err)
+	}
+
+	// Another host key within the same build is a mismatch
+	if err := testSshConnect(t, otherAddress, state); err == nil {
+		t.Fatal("Expected an error for a changed host key")
+	}
+}
+
+func TestSshConfig_IsValidFingerprint(t *testing.T) {
+	valid := []string{
+		"SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU",
+		"MD5:16:27:ac:a5:76:28:2d:36:63:1b:56:4d:eb:df:a6:48",
+		"16:27:AC:A5:76:28:2D:36:63:1B:56:4D:EB:DF:A6:48",
+	}
+	for _, fingerprint := range valid {
+		if !isValidFingerprint(fingerprint) {
+			t.Fatalf("Expected '%s' to be valid", fingerprint)
+		}
+	}
+
+	invalid := []string{"SHA256:short", "16:27:ac", "not a fingerprint"}
+	for _, fingerprint := range invalid {
+		if isValidFingerprint(fingerprint) {
+			t.Fatalf("Expected '%s' to be invalid", fingerprint)
+		}
+	}
+}
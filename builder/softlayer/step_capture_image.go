@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/mitchellh/multistep"
 	"github.com/mitchellh/packer/packer"
+	"strings"
 )
 
 type stepCaptureImage struct{}
@@ -13,8 +14,10 @@ func (self *stepCaptureImage) Run(state multistep.StateBag) multistep.StepAction
 	ui := state.Get("ui").(packer.Ui)
 	instance := state.Get("instance_data").(map[string]interface{})
 	config := state.Get("config").(Config)
+	imageName := state.Get("image_name").(string)
 	instanceId := instance["globalIdentifier"].(string)
 	var imageId string
+	var templateGroupId int64
 
 	ui.Say(fmt.Sprintf("Preparing for capturing the instance image. Image snapshot type is '%s'.", config.ImageType))
 
@@ -32,7 +35,17 @@ func (self *stepCaptureImage) Run(state multistep.StateBag) multistep.StepAction
 		blockDeviceIds := client.findNonSwapBlockDeviceIds(blockDevices)
 		ui.Say(fmt.Sprintf("Will capture standard image using these block devices: %v", blockDeviceIds))
 
-		_, err = client.captureStandardImage(instanceId, config.ImageName, config.ImageDescription, blockDeviceIds)
+		// The images existing before the capture can't be the captured one
+		images, err := client.getBlockDeviceTemplateGroups()
+		if err != nil {
+			err := fmt.Errorf("Error while trying to capture an image from instance (id=%s). Unable to list the images. Error: %s", instanceId, err)
+			ui.Error(err.Error())
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+		knownIds := imageIds(images)
+
+		transaction, err := client.captureStandardImage(instanceId, imageName, config.ImageDescription, blockDeviceIds)
 		if err != nil {
 			err := fmt.Errorf("Error while trying to capture an image from instance (id=%s). Error: %s", instanceId, err)
 			ui.Error(err.Error())
@@ -40,16 +53,23 @@ func (self *stepCaptureImage) Run(state multistep.StateBag) multistep.StepAction
 			return multistep.ActionHalt
 		}
 
-		imageId, err = client.findImageIdByName(config.ImageName)
+		// Follow the archive transaction to the image it creates, names aren't necessarily unique
+		transactionId := int64(transaction["id"].(float64))
+		ui.Say(fmt.Sprintf("Looking up the image created by transaction (id=%d)", transactionId))
+
+		image, err := client.waitForImageByTransaction(transactionId, imageName, knownIds, config.StateTimeout)
 		if err != nil {
 			err := fmt.Errorf("Error while trying to capture an image from instance (id=%s). Could not get image id. Error: %s", instanceId, err)
 			ui.Error(err.Error())
 			state.Put("error", err)
 			return multistep.ActionHalt
 		}
+
+		imageId = image["globalIdentifier"].(string)
+		templateGroupId = int64(image["id"].(float64))
 	} else {
 		// Flex Image
-		data, err := client.captureImage(instanceId, config.ImageName, config.ImageDescription)
+		data, err := client.captureImage(instanceId, imageName, config.ImageDescription)
 		if err != nil {
 			err := fmt.Errorf("Error while trying to capture an image from instance (id=%s). Error: %s", instanceId, err)
 			ui.Error(err.Error())
@@ -58,16 +78,35 @@ func (self *stepCaptureImage) Run(state multistep.StateBag) multistep.StepAction
 		}
 
 		imageId = data["globalIdentifier"].(string)
+		templateGroupId = int64(data["id"].(float64))
 	}
 
 	state.Put("image_id", imageId)
+	state.Put("image_template_group_id", templateGroupId)
+
+	// Tag the image while it is still being created, so that the cleanup command also finds the half-finished
+	// image of a crashed build. The build tags are removed once the build succeeds, see stepFinalizeImage
+	tags := append(append([]string{}, config.ImageTags...), buildTags(state)...)
+	ui.Say(fmt.Sprintf("Tagging image (%s) with: %s", imageId, strings.Join(tags, ", ")))
+	err := client.setImageTags(templateGroupId, tags)
+	if err != nil {
+		err := fmt.Errorf("Error tagging image (%s). Error: %s", imageId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
 	ui.Say(fmt.Sprintf("Waiting for image (%s) to finish its creation...", imageId))
 
-	// We are waiting for the instance since the waiting process checks for active transactions.
-	// The image will be ready when no active transactions will be set for the snapshotted instance.
-	err := client.waitForInstanceReady(instanceId, config.StateTimeout)
+	lastPercent := -1
+	err = client.waitForImageReady(templateGroupId, config.StateTimeout, func(percent int) {
+		if percent != lastPercent {
+			lastPercent = percent
+			ui.Message(fmt.Sprintf("Image creation progress: %d%%", percent))
+		}
+	})
 	if err != nil {
-		err := fmt.Errorf("Error waiting for instance to become ACTIVE again after image creation call. Error: %s", err)
+		err := fmt.Errorf("Error waiting for image (%s) to finish its creation. Error: %s", imageId, err)
 		ui.Error(err.Error())
 		state.Put("error", err)
 		return multistep.ActionHalt
@@ -0,0 +1,55 @@
+package softlayer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"os"
+)
+
+// stepConnectSshAgent connects to the local ssh agent when ssh_agent_auth is set. The communicator
+// retries its connection until sshd is up, every attempt shares this agent connection.
+type stepConnectSshAgent struct {
+	conn net.Conn
+}
+
+func (self *stepConnectSshAgent) Run(state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	if !config.SSHAgentAuth {
+		return multistep.ActionContinue
+	}
+
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		err := errors.New("Error connecting to the ssh agent: ssh_agent_auth is set but SSH_AUTH_SOCK is not")
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		err := fmt.Errorf("Error connecting to the ssh agent: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	self.conn = conn
+	state.Put("ssh_agent", agent.NewClient(conn))
+
+	return multistep.ActionContinue
+}
+
+func (self *stepConnectSshAgent) Cleanup(state multistep.StateBag) {
+	if self.conn == nil {
+		return
+	}
+
+	self.conn.Close()
+}
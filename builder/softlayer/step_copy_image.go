@@ -0,0 +1,77 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"strings"
+)
+
+// stepCopyImage makes the captured image available in the additional image_datacenters.
+type stepCopyImage struct{}
+
+func (self *stepCopyImage) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+	imageId := state.Get("image_id").(string)
+	templateGroupId := state.Get("image_template_group_id").(int64)
+
+	datacenters := []string{config.DatacenterName}
+	var copyDatacenters []string
+	for _, datacenter := range config.ImageDatacenters {
+		if !containsString(datacenters, datacenter) {
+			datacenters = append(datacenters, datacenter)
+			copyDatacenters = append(copyDatacenters, datacenter)
+		}
+	}
+
+	if len(copyDatacenters) == 0 {
+		state.Put("image_datacenters", datacenters)
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Copying image (%s) to: %s", imageId, strings.Join(copyDatacenters, ", ")))
+
+	datacenterIds, err := client.findDatacenterIds(copyDatacenters)
+	if err != nil {
+		err := fmt.Errorf("Error copying image (%s): %s", imageId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	err = client.addImageLocations(templateGroupId, datacenterIds)
+	if err != nil {
+		err := fmt.Errorf("Error copying image (%s): %s", imageId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Waiting for the image copies to finish...")
+	err = client.waitForImageLocationsReady(templateGroupId, copyDatacenters, config.StateTimeout)
+	if err != nil {
+		err := fmt.Errorf("Error waiting for image (%s) to be copied: %s", imageId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	state.Put("image_datacenters", datacenters)
+
+	return multistep.ActionContinue
+}
+
+func (self *stepCopyImage) Cleanup(state multistep.StateBag) {
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/mitchellh/multistep"
 	"github.com/mitchellh/packer/packer"
 	"log"
+	"strings"
+	"time"
 )
 
 type stepCreateInstance struct {
@@ -16,27 +18,7 @@ func (self *stepCreateInstance) Run(state multistep.StateBag) multistep.StepActi
 	config := state.Get("config").(Config)
 	ui := state.Get("ui").(packer.Ui)
 
-	// The ssh_key_id can be empty if the user specified a private key
-	sshKeyId := state.Get("ssh_key_id")
-	var ProvisioningSshKeyId int64 = 0
-	if sshKeyId != nil {
-		ProvisioningSshKeyId = sshKeyId.(int64)
-	}
-
-	instanceDefinition := &InstanceType{
-		HostName:             config.InstanceName,
-		Domain:               config.InstanceDomain,
-		Datacenter:           config.DatacenterName,
-		Cpus:                 config.InstanceCpu,
-		Memory:               config.InstanceMemory,
-		HourlyBillingFlag:    true,
-		LocalDiskFlag:        true,
-		DiskCapacity:         config.InstanceDiskCapacity,
-		NetworkSpeed:         config.InstanceNetworkSpeed,
-		ProvisioningSshKeyId: ProvisioningSshKeyId,
-		BaseImageId:          config.BaseImageId,
-		BaseOsCode:           config.BaseOsCode,
-	}
+	instanceDefinition := newInstanceDefinition(state)
 
 	ui.Say("Creating an instance...")
 	instanceData, err := client.CreateInstance(*instanceDefinition)
@@ -47,12 +29,63 @@ func (self *stepCreateInstance) Run(state multistep.StateBag) multistep.StepActi
 	}
 
 	state.Put("instance_data", instanceData)
+	state.Put("instance_created_at", time.Now())
 	self.instanceId = instanceData["globalIdentifier"].(string)
 	ui.Say(fmt.Sprintf("Created instance, id: '%s'", instanceData["globalIdentifier"].(string)))
 
+	// The build tags let the cleanup command find the instance if the build crashes
+	tags := append(append([]string{}, config.InstanceTags...), buildTags(state)...)
+	ui.Say(fmt.Sprintf("Tagging instance with: %s", strings.Join(tags, ", ")))
+	err = client.setInstanceTags(self.instanceId, tags)
+	if err != nil {
+		err := fmt.Errorf("Error tagging instance (%s): %s", self.instanceId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
 	return multistep.ActionContinue
 }
 
+// newInstanceDefinition translates the builder configuration into the instance to order.
+func newInstanceDefinition(state multistep.StateBag) *InstanceType {
+	config := state.Get("config").(Config)
+
+	// The ssh_key_id can be empty if the user specified a private key
+	var provisioningSshKeyId int64 = 0
+	if sshKeyId, ok := state.GetOk("ssh_key_id"); ok {
+		provisioningSshKeyId = sshKeyId.(int64)
+	}
+
+	var sshKeyIds []int64
+	if accountKeyIds, ok := state.GetOk("ssh_account_key_ids"); ok {
+		sshKeyIds = accountKeyIds.([]int64)
+	}
+
+	// The base image can be prepared during the build instead of being configured
+	baseImageId := config.BaseImageId
+	if preparedImageId, ok := state.GetOk("base_image_id"); ok {
+		baseImageId = preparedImageId.(string)
+	}
+
+	return &InstanceType{
+		HostName:             config.InstanceName,
+		Domain:               config.InstanceDomain,
+		Datacenter:           config.DatacenterName,
+		Cpus:                 config.InstanceCpu,
+		Memory:               config.InstanceMemory,
+		HourlyBillingFlag:    true,
+		LocalDiskFlag:        true,
+		DiskCapacity:         config.InstanceDiskCapacity,
+		NetworkSpeed:         config.InstanceNetworkSpeed,
+		ProvisioningSshKeyId: provisioningSshKeyId,
+		BaseImageId:          baseImageId,
+		BaseOsCode:           config.BaseOsCode,
+		SshKeyIds:            sshKeyIds,
+		PrivateNetworkOnly:   config.InstancePrivateNetworkOnly,
+	}
+}
+
 func (self *stepCreateInstance) Cleanup(state multistep.StateBag) {
 	client := state.Get("client").(*SoftlayerClient)
 	config := state.Get("config").(Config)
@@ -62,6 +95,20 @@ func (self *stepCreateInstance) Cleanup(state multistep.StateBag) {
 		return
 	}
 
+	if keepInstanceOnError(state) {
+		state.Put("kept_instance", true)
+		reportKeptInstance(state, self.instanceId)
+		reportBuildCost(state)
+
+		// The cleanup command must not delete the kept instance once the build expires
+		if err := client.setInstanceTags(self.instanceId, config.InstanceTags); err != nil {
+			log.Printf("Error removing the build tags of the kept instance: %v", err.Error())
+			ui.Error(fmt.Sprintf("Error removing the build tags of the kept instance (%s). Please remove the '%s' tags manually, or the cleanup command deletes it",
+				self.instanceId, BUILD_EXPIRES_TAG_PREFIX))
+		}
+		return
+	}
+
 	ui.Say("Waiting for the instance to have no active transactions before destroying it...")
 
 	// We should wait until the instance is up/have no transactions,
@@ -77,5 +124,15 @@ func (self *stepCreateInstance) Cleanup(state multistep.StateBag) {
 	if err != nil {
 		log.Printf("Error destroying instance: %v", err.Error())
 		ui.Error(fmt.Sprintf("Error cleaning up the instance. Please delete the instance (%s) manually", self.instanceId))
+		return
+	}
+
+	state.Put("instance_destroyed_at", time.Now())
+
+	// A failed build returns no artifact to report the cost with, the instance was billed all the same
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if cancelled || halted {
+		reportBuildCost(state)
 	}
 }
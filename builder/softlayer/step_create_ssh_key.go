@@ -1,14 +1,8 @@
 package softlayer
 
 import (
-	"code.google.com/p/gosshold/ssh"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"github.com/mitchellh/multistep"
-	"github.com/mitchellh/packer/common/uuid"
 	"github.com/mitchellh/packer/packer"
 	"io/ioutil"
 	"log"
@@ -21,7 +15,14 @@ type stepCreateSshKey struct {
 }
 
 func (self *stepCreateSshKey) Run(state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(Config)
 	ui := state.Get("ui").(packer.Ui)
+
+	// Only the ssh communicator uses the key
+	if config.Comm.Type != "ssh" {
+		return multistep.ActionContinue
+	}
+
 	if self.PrivateKeyFile != "" {
 		ui.Say(fmt.Sprintf("Reading private key file (%s)...", self.PrivateKeyFile))
 
@@ -33,52 +34,89 @@ func (self *stepCreateSshKey) Run(state multistep.StateBag) multistep.StepAction
 
 		state.Put("ssh_private_key", string(privateKeyBytes))
 
+		if len(config.SSHKeyIds) > 0 || len(config.SSHKeyLabels) > 0 {
+			return self.attachAccountKeys(state, string(privateKeyBytes))
+		}
+
 		return multistep.ActionContinue
 	}
 
 	client := state.Get("client").(*SoftlayerClient)
-	ui.Say("Creating temporary ssh key for the instance...")
+	ui.Say(fmt.Sprintf("Creating temporary %s ssh key for the instance...", config.TemporaryKeyType))
 
-	rsaKey, err := rsa.GenerateKey(rand.Reader, 2014)
+	privateKey, publicKey, err := generateTemporaryKey(config.TemporaryKeyType, config.TemporaryKeyBits)
 	if err != nil {
 		ui.Error(err.Error())
 		state.Put("error", err)
 		return multistep.ActionHalt
 	}
 
-	// ASN.1 DER encoded form
-	privDer := x509.MarshalPKCS1PrivateKey(rsaKey)
-	privBlk := pem.Block{
-		Type:    "RSA PRIVATE KEY",
-		Headers: nil,
-		Bytes:   privDer,
-	}
-
 	// Set the private key in the statebag for later
-	state.Put("ssh_private_key", string(pem.EncodeToMemory(&privBlk)))
+	state.Put("ssh_private_key", privateKey)
+
+	// Keep a copy of the key to debug the instance with
+	if config.TemporaryKeyFile != "" {
+		ui.Message(fmt.Sprintf("Saving the temporary private key to %s", config.TemporaryKeyFile))
+		err := ioutil.WriteFile(config.TemporaryKeyFile, []byte(privateKey), 0600)
+		if err != nil {
+			err := fmt.Errorf("Error saving the temporary private key: %s", err)
+			ui.Error(err.Error())
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+	}
 
-	pub, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	// The name of the public key, keys can't be tagged so the build tags go in the notes
+	label := fmt.Sprintf("packer-%s", state.Get("build_id").(string))
+	keyId, err := client.UploadSshKey(label, publicKey, strings.Join(buildTags(state), " "))
 	if err != nil {
 		ui.Error(err.Error())
 		state.Put("error", err)
 		return multistep.ActionHalt
 	}
 
-	publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	self.keyId = keyId
+	state.Put("ssh_key_id", keyId)
+
+	ui.Say(fmt.Sprintf("Created SSH key with id '%d'", keyId))
 
-	// The name of the public key
-	label := fmt.Sprintf("packer-%s", uuid.TimeOrderedUUID())
-	keyId, err := client.UploadSshKey(label, publicKey)
+	return multistep.ActionContinue
+}
+
+// attachAccountKeys selects the existing account keys to attach to the instance.
+func (self *stepCreateSshKey) attachAccountKeys(state multistep.StateBag, privateKey string) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("Looking up the ssh keys of the account...")
+
+	keys, err := client.getSshKeys()
 	if err != nil {
+		err := fmt.Errorf("Error listing the ssh keys of the account: %s", err)
 		ui.Error(err.Error())
 		state.Put("error", err)
 		return multistep.ActionHalt
 	}
 
-	self.keyId = keyId
-	state.Put("ssh_key_id", keyId)
+	signer, err := parsePrivateKey(privateKey, config.SSHPrivateKeyPassphrase)
+	if err != nil {
+		err := fmt.Errorf("Error reading the private key: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
 
-	ui.Say(fmt.Sprintf("Created SSH key with id '%d'", keyId))
+	keyIds, err := findAccountSshKeys(keys, config.SSHKeyIds, config.SSHKeyLabels, signer.PublicKey())
+	if err != nil {
+		err := fmt.Errorf("Error selecting the ssh keys: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf("Attaching the ssh keys with ids %v", keyIds))
+	state.Put("ssh_account_key_ids", keyIds)
 
 	return multistep.ActionContinue
 }
@@ -92,6 +130,19 @@ func (self *stepCreateSshKey) Cleanup(state multistep.StateBag) {
 	client := state.Get("client").(*SoftlayerClient)
 	ui := state.Get("ui").(packer.Ui)
 
+	// The kept instance may need the key to be reinstalled, without an instance there is nothing to debug
+	if _, ok := state.GetOk("kept_instance"); ok {
+		ui.Say(fmt.Sprintf("Keeping the temporary ssh key (%d). Please delete it manually once done.", self.keyId))
+
+		// Drop the build tags from the notes, so the cleanup command keeps the key too
+		if err := client.setSshKeyNotes(self.keyId, "Kept for debugging a failed packer.io build"); err != nil {
+			log.Printf("Error removing the build tags of the kept ssh key: %v", err.Error())
+			ui.Error(fmt.Sprintf("Error removing the build tags of the kept ssh key (%d). Please clear its notes manually, or the cleanup command deletes it",
+				self.keyId))
+		}
+		return
+	}
+
 	ui.Say("Deleting temporary ssh key...")
 	err := client.DestroySshKey(self.keyId)
 
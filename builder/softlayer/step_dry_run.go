@@ -0,0 +1,106 @@
+package softlayer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+)
+
+// stepDryRun shows what a build would order and capture, and what the instance would cost,
+// without creating anything.
+type stepDryRun struct{}
+
+func (self *stepDryRun) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+	imageName := state.Get("image_name").(string)
+
+	instanceRequest := client.generateInstanceRequest(*newInstanceDefinition(state))
+
+	var captureRequest []interface{}
+	if config.ImageType == IMAGE_TYPE_STANDARD {
+		// The block devices to capture are only known once the instance exists
+		captureRequest = []interface{}{imageName, []*BlockDevice{}, config.ImageDescription}
+	} else {
+		captureRequest = []interface{}{
+			&InstanceImage{
+				Descption: config.ImageDescription,
+				Name:      imageName,
+				Summary:   config.ImageDescription,
+			},
+		}
+	}
+
+	type payload struct {
+		title      string
+		parameters []interface{}
+	}
+	payloads := []payload{
+		{"Instance request (SoftLayer_Virtual_Guest::createObject)", []interface{}{instanceRequest}},
+	}
+
+	// There is no order when the base image is imported during the build
+	rawOrderTemplate, hasOrder := state.GetOk("order_template")
+	if hasOrder {
+		payloads = append(payloads, payload{"Order (SoftLayer_Product_Order::verifyOrder)", []interface{}{rawOrderTemplate}})
+	}
+	payloads = append(payloads, payload{fmt.Sprintf("Capture request for a %s image", config.ImageType), captureRequest})
+
+	for _, payload := range payloads {
+		body, err := json.MarshalIndent(&SoftLayerRequest{Parameters: payload.parameters}, "", "  ")
+		if err != nil {
+			ui.Error(err.Error())
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+
+		ui.Say(payload.title + ":")
+		ui.Message(string(body))
+	}
+
+	if !hasOrder {
+		ui.Say("The instance can't be priced before its base image is imported.")
+		ui.Say("Dry run finished, nothing was created.")
+		return multistep.ActionContinue
+	}
+
+	ui.Say("Verifying the order...")
+	order, err := client.verifyOrder(rawOrderTemplate.(map[string]interface{}))
+	if err != nil {
+		err := fmt.Errorf("Error verifying the instance order: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Hourly price of the build instance: %.4f", orderHourlyPrice(order)))
+	ui.Say("Dry run finished, nothing was created.")
+
+	return multistep.ActionContinue
+}
+
+func (self *stepDryRun) Cleanup(state multistep.StateBag) {
+}
+
+// orderHourlyPrice sums up the hourly fees of the prices in a verified order.
+func orderHourlyPrice(order map[string]interface{}) float64 {
+	quantity := 1.
+	if value, ok := order["quantity"].(float64); ok && value > 0 {
+		quantity = value
+	}
+
+	total := 0.
+	prices, _ := order["prices"].([]interface{})
+	for _, val := range prices {
+		price, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		total += parseFloat(price["hourlyRecurringFee"])
+	}
+
+	return total * quantity
+}
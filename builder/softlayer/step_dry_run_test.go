@@ -0,0 +1,30 @@
+package softlayer
+
+import (
+	"testing"
+)
+
+func TestDryRun_OrderHourlyPrice(t *testing.T) {
+	order := map[string]interface{}{
+		"quantity": 1.,
+		"prices": []interface{}{
+			map[string]interface{}{"hourlyRecurringFee": ".025"},
+			map[string]interface{}{"hourlyRecurringFee": "0.015"},
+			map[string]interface{}{"hourlyRecurringFee": 0.01},
+			map[string]interface{}{"recurringFee": "20"},
+		},
+	}
+
+	if price := orderHourlyPrice(order); price < 0.0499 || price > 0.0501 {
+		t.Fatalf("Expected an hourly price of 0.05 but got %f", price)
+	}
+
+	order["quantity"] = 2.
+	if price := orderHourlyPrice(order); price < 0.0999 || price > 0.1001 {
+		t.Fatalf("Expected an hourly price of 0.1 but got %f", price)
+	}
+
+	if price := orderHourlyPrice(map[string]interface{}{}); price != 0 {
+		t.Fatalf("Expected no price for an empty order but got %f", price)
+	}
+}
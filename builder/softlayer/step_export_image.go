@@ -0,0 +1,61 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+)
+
+// stepExportImage copies the captured image as a VHD file to object storage.
+type stepExportImage struct{}
+
+func (self *stepExportImage) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+	imageId := state.Get("image_id").(string)
+	templateGroupId := state.Get("image_template_group_id").(int64)
+
+	if !config.Export.IsSet() {
+		return multistep.ActionContinue
+	}
+
+	uri := config.Export.Uri()
+	ui.Say(fmt.Sprintf("Exporting image (%s) to %s...", imageId, uri))
+
+	configuration := &ImageTransferConfiguration{
+		Name: state.Get("image_name").(string),
+		Uri:  uri,
+	}
+
+	var err error
+	if config.Export.Type == OBJECT_STORAGE_SWIFT {
+		err = client.copyImageToExternalSource(templateGroupId, configuration)
+	} else {
+		configuration.IbmApiKey = config.Export.IBMApiKey
+		err = client.copyImageToIcos(templateGroupId, configuration)
+	}
+
+	if err != nil {
+		err := fmt.Errorf("Error exporting image (%s): %s", imageId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Waiting for the export to finish...")
+	err = client.waitForImageTransaction(templateGroupId, config.StateTimeout)
+	if err != nil {
+		err := fmt.Errorf("Error waiting for image (%s) to be exported: %s", imageId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	state.Put("image_export_uri", uri)
+
+	return multistep.ActionContinue
+}
+
+func (self *stepExportImage) Cleanup(state multistep.StateBag) {
+}
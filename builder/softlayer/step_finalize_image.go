@@ -0,0 +1,33 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+)
+
+// stepFinalizeImage removes the build tags from the image once the build succeeded,
+// so the cleanup command doesn't delete it when they expire.
+type stepFinalizeImage struct{}
+
+func (self *stepFinalizeImage) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+	imageId := state.Get("image_id").(string)
+	templateGroupId := state.Get("image_template_group_id").(int64)
+
+	ui.Say(fmt.Sprintf("Removing the build tags from the image (%s)...", imageId))
+	err := client.setImageTags(templateGroupId, config.ImageTags)
+	if err != nil {
+		err := fmt.Errorf("Error removing the build tags from the image (%s): %s", imageId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (self *stepFinalizeImage) Cleanup(state multistep.StateBag) {
+}
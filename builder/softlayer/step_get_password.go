@@ -0,0 +1,52 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+)
+
+// stepGetPassword fetches the password SoftLayer provisioned the instance with, when the
+// communicator needs it and no password was configured.
+type stepGetPassword struct{}
+
+func (self *stepGetPassword) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	var username string
+	switch {
+	case config.Comm.Type == "winrm" && config.Comm.WinRMPassword == "":
+		username = config.Comm.WinRMUser
+	case config.Comm.Type == "ssh" && config.SSHUseProvisionedPassword:
+		username = config.Comm.SSHUsername
+	default:
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Waiting for the password of '%s' to become available...", username))
+
+	instance := state.Get("instance_data").(map[string]interface{})
+	instanceId := instance["globalIdentifier"].(string)
+
+	var password string
+	err := client.waitFor("password", config.StateTimeout, func() (bool, error) {
+		var err error
+		password, err = client.getInstancePassword(instanceId, username)
+		return password != "", err
+	})
+	if err != nil {
+		err := fmt.Errorf("Error getting the password of '%s': %s", username, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("instance_password", password)
+
+	return multistep.ActionContinue
+}
+
+func (self *stepGetPassword) Cleanup(state multistep.StateBag) {
+}
@@ -0,0 +1,98 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"log"
+)
+
+// stepImportBaseImage imports the base_image_source file from object storage and uses it as the base image.
+type stepImportBaseImage struct {
+	templateGroupId int64
+	imported        bool
+}
+
+func (self *stepImportBaseImage) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+	source := config.BaseImageSource
+
+	if !source.IsSet() {
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Importing the base image from %s...", source.Uri()))
+
+	configuration := &ImageTransferConfiguration{
+		Name:            fmt.Sprintf("%s-base", config.ImageName),
+		Note:            "Base image imported by packer.io",
+		Uri:             source.Uri(),
+		OsReferenceCode: source.OsCode,
+	}
+
+	var image map[string]interface{}
+	var err error
+	if source.Type == OBJECT_STORAGE_SWIFT {
+		image, err = client.createImageFromExternalSource(configuration)
+	} else {
+		configuration.IbmApiKey = source.IBMApiKey
+		image, err = client.createImageFromIcos(configuration)
+	}
+
+	if err != nil {
+		err := fmt.Errorf("Error importing the base image: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	self.templateGroupId = int64(image["id"].(float64))
+	imageId := image["globalIdentifier"].(string)
+
+	// An image deleted after the build only lives as long as the build
+	if source.DeleteAfterBuild {
+		err = client.setImageTags(self.templateGroupId, buildTags(state))
+		if err != nil {
+			err := fmt.Errorf("Error tagging the base image (%s): %s", imageId, err)
+			ui.Error(err.Error())
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+	}
+
+	ui.Say(fmt.Sprintf("Waiting for the base image (%s) import to finish...", imageId))
+	err = client.waitForImageTransaction(self.templateGroupId, config.StateTimeout)
+	if err != nil {
+		err := fmt.Errorf("Error waiting for the base image (%s) to be imported: %s", imageId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	self.imported = true
+	state.Put("base_image_id", imageId)
+	ui.Say(fmt.Sprintf("Imported the base image, id: '%s'", imageId))
+
+	return multistep.ActionContinue
+}
+
+func (self *stepImportBaseImage) Cleanup(state multistep.StateBag) {
+	config := state.Get("config").(Config)
+
+	// Keep a successfully imported image unless it should be deleted, a failed import is of no use
+	if self.templateGroupId == 0 || (self.imported && !config.BaseImageSource.DeleteAfterBuild) {
+		return
+	}
+
+	client := state.Get("client").(*SoftlayerClient)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("Deleting the imported base image...")
+	err := client.deleteImage(self.templateGroupId)
+	if err != nil {
+		log.Printf("Error deleting the imported base image: %v", err.Error())
+		ui.Error(fmt.Sprintf("Error deleting the imported base image. Please delete the image (%d) manually", self.templateGroupId))
+	}
+}
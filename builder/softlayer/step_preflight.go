@@ -0,0 +1,245 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stepPreflight validates the configuration against what SoftLayer can actually provision,
+// before anything billable is created.
+type stepPreflight struct{}
+
+func (self *stepPreflight) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("Validating the configuration against the available instance options...")
+
+	options, err := client.getCreateObjectOptions()
+	if err != nil {
+		err := fmt.Errorf("Error fetching the available instance options: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	state.Put("create_object_options", options)
+	errs := validateCreateObjectOptions(config, options)
+
+	images, err := client.getBlockDeviceTemplateGroups()
+	if err != nil {
+		err := fmt.Errorf("Error listing the images of the account: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	imageName, replacedImages, err := resolveImageName(config, images)
+	if err != nil {
+		errs = append(errs, err)
+	} else if imageName != config.ImageName {
+		ui.Say(fmt.Sprintf("An image named '%s' already exists, the image will be named '%s'.", config.ImageName, imageName))
+	} else if len(replacedImages) > 0 {
+		ui.Say(fmt.Sprintf("An image named '%s' already exists, it will be replaced once the new image is ready.", imageName))
+	}
+	state.Put("image_name", imageName)
+	state.Put("replaced_images", replacedImages)
+
+	if len(errs) > 0 {
+		err := &packer.MultiError{Errors: errs}
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	// The order can only be verified once the imported base image exists
+	if config.BaseImageSource.IsSet() {
+		ui.Say("Skipping the instance order verification, the base image is imported during the build.")
+		return multistep.ActionContinue
+	}
+
+	// Let SoftLayer verify the complete instance request without ordering it
+	orderTemplate, err := client.generateOrderTemplate(*newInstanceDefinition(state))
+	if err != nil {
+		err := fmt.Errorf("Error verifying the instance order: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	state.Put("order_template", orderTemplate)
+
+	return multistep.ActionContinue
+}
+
+func (self *stepPreflight) Cleanup(state multistep.StateBag) {
+}
+
+// validateCreateObjectOptions checks the configuration against the result of
+// SoftLayer_Virtual_Guest::getCreateObjectOptions and returns an error for every invalid value.
+func validateCreateObjectOptions(config Config, options map[string]interface{}) []error {
+	var errs []error
+
+	check := func(name string, value string, choices []string) {
+		// Nothing to check against when SoftLayer lists no choices
+		if len(choices) == 0 {
+			return
+		}
+
+		for _, choice := range choices {
+			if choice == value {
+				return
+			}
+		}
+
+		errs = append(errs, fmt.Errorf("Invalid %s '%s'. Valid choices are: %s", name, value, strings.Join(choices, ", ")))
+	}
+
+	datacenters := createObjectOptionValues(options, "datacenters", nil, "datacenter", "name")
+	check("datacenter_name", config.DatacenterName, datacenters)
+	for _, datacenter := range config.ImageDatacenters {
+		check("image_datacenters entry", datacenter, datacenters)
+	}
+	check("instance_cpu", strconv.Itoa(config.InstanceCpu),
+		createObjectOptionValues(options, "processors", nil, "startCpus"))
+	check("instance_memory", strconv.FormatInt(config.InstanceMemory, 10),
+		createObjectOptionValues(options, "memory", nil, "maxMemory"))
+	check("instance_network_speed", strconv.Itoa(config.InstanceNetworkSpeed),
+		createObjectOptionValues(options, "networkComponents", nil, "networkComponents", "maxSpeed"))
+
+	// The OS and the disks are only chosen by us when the instance isn't built from an image
+	if config.BaseOsCode != "" {
+		check("base_os_code", config.BaseOsCode,
+			createObjectOptionValues(options, "operatingSystems", nil, "operatingSystemReferenceCode"))
+
+		check("instance_disk_capacity", strconv.Itoa(config.InstanceDiskCapacity),
+			createObjectOptionValues(options, "blockDevices", isPrimarySanDisk, "blockDevices", "diskImage", "capacity"))
+	}
+
+	return errs
+}
+
+// resolveImageName applies the image_name_conflict policy to the images of the account. It returns
+// the name to give the new image, and the existing images it replaces.
+func resolveImageName(config Config, images []interface{}) (string, []map[string]interface{}, error) {
+	var names []string
+	var conflicts []map[string]interface{}
+	for _, val := range images {
+		image, ok := val.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := image["name"].(string)
+		names = append(names, name)
+		if name == config.ImageName && image["globalIdentifier"] != nil {
+			conflicts = append(conflicts, image)
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return config.ImageName, nil, nil
+	}
+
+	switch config.ImageNameConflict {
+	case IMAGE_NAME_CONFLICT_REPLACE:
+		return config.ImageName, conflicts, nil
+	case IMAGE_NAME_CONFLICT_SUFFIX:
+		for suffix := 2; ; suffix++ {
+			name := fmt.Sprintf("%s-%d", config.ImageName, suffix)
+			if !containsString(names, name) {
+				return name, nil, nil
+			}
+		}
+	default:
+		return "", nil, fmt.Errorf("An image named '%s' already exists (id: %v). Set image_name_conflict to 'replace' or 'suffix' to build it anyway.",
+			config.ImageName, conflicts[0]["globalIdentifier"])
+	}
+}
+
+// isPrimarySanDisk matches the block device options for the single SAN disk we order as the first block device.
+func isPrimarySanDisk(template map[string]interface{}) bool {
+	device, _ := lookupOptionValue(template, "blockDevices", "device")
+	localDisk, _ := lookupOptionValue(template, "localDiskFlag")
+	return device == "0" && localDisk != true
+}
+
+// createObjectOptionValues collects the distinct values found at the given path of every
+// template in an option group, optionally skipping the templates rejected by filter.
+func createObjectOptionValues(options map[string]interface{}, group string, filter func(map[string]interface{}) bool, path ...string) []string {
+	var values []string
+	seen := make(map[string]bool)
+
+	entries, _ := options[group].([]interface{})
+	for _, entry := range entries {
+		entryMap, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		template, ok := entryMap["template"].(map[string]interface{})
+		if !ok || (filter != nil && !filter(template)) {
+			continue
+		}
+
+		value, ok := lookupOptionValue(template, path...)
+		if !ok {
+			continue
+		}
+
+		valueString := fmt.Sprintf("%v", value)
+		if !seen[valueString] {
+			seen[valueString] = true
+			values = append(values, valueString)
+		}
+	}
+
+	sort.Sort(optionValues(values))
+
+	return values
+}
+
+// lookupOptionValue follows a path of keys through a decoded JSON object. Lists found along
+// the way are entered through their first element.
+func lookupOptionValue(value interface{}, path ...string) (interface{}, bool) {
+	for _, key := range path {
+		if list, ok := value.([]interface{}); ok {
+			if len(list) == 0 {
+				return nil, false
+			}
+			value = list[0]
+		}
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		value, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// optionValues sorts numeric values by their value and everything else alphabetically.
+type optionValues []string
+
+func (self optionValues) Len() int      { return len(self) }
+func (self optionValues) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+func (self optionValues) Less(i, j int) bool {
+	left, leftErr := strconv.ParseFloat(self[i], 64)
+	right, rightErr := strconv.ParseFloat(self[j], 64)
+	if leftErr == nil && rightErr == nil {
+		return left < right
+	}
+
+	return self[i] < self[j]
+}
@@ -0,0 +1,219 @@
+package softlayer
+
+import (
+	"strings"
+	"testing"
+)
+
+func testCreateObjectOptions() map[string]interface{} {
+	return map[string]interface{}{
+		"datacenters": []interface{}{
+			map[string]interface{}{
+				"template": map[string]interface{}{
+					"datacenter": map[string]interface{}{"name": "dal10"},
+				},
+			},
+			map[string]interface{}{
+				"template": map[string]interface{}{
+					"datacenter": map[string]interface{}{"name": "ams01"},
+				},
+			},
+		},
+		"processors": []interface{}{
+			map[string]interface{}{"template": map[string]interface{}{"startCpus": 4.}},
+			map[string]interface{}{"template": map[string]interface{}{"startCpus": 1.}},
+			map[string]interface{}{"template": map[string]interface{}{"startCpus": 2.}},
+		},
+		"memory": []interface{}{
+			map[string]interface{}{"template": map[string]interface{}{"maxMemory": 1024.}},
+			map[string]interface{}{"template": map[string]interface{}{"maxMemory": 2048.}},
+		},
+		"networkComponents": []interface{}{
+			map[string]interface{}{
+				"template": map[string]interface{}{
+					"networkComponents": []interface{}{
+						map[string]interface{}{"maxSpeed": 10.},
+					},
+				},
+			},
+			map[string]interface{}{
+				"template": map[string]interface{}{
+					"networkComponents": []interface{}{
+						map[string]interface{}{"maxSpeed": 100.},
+					},
+				},
+			},
+		},
+		"operatingSystems": []interface{}{
+			map[string]interface{}{
+				"template": map[string]interface{}{"operatingSystemReferenceCode": "CENTOS_6_64"},
+			},
+		},
+		"blockDevices": []interface{}{
+			map[string]interface{}{
+				"template": map[string]interface{}{
+					"blockDevices": []interface{}{
+						map[string]interface{}{
+							"device":    "0",
+							"diskImage": map[string]interface{}{"capacity": 25.},
+						},
+					},
+					"localDiskFlag": false,
+				},
+			},
+			map[string]interface{}{
+				"template": map[string]interface{}{
+					"blockDevices": []interface{}{
+						map[string]interface{}{
+							"device":    "0",
+							"diskImage": map[string]interface{}{"capacity": 50.},
+						},
+					},
+					"localDiskFlag": true,
+				},
+			},
+			map[string]interface{}{
+				"template": map[string]interface{}{
+					"blockDevices": []interface{}{
+						map[string]interface{}{
+							"device":    "2",
+							"diskImage": map[string]interface{}{"capacity": 100.},
+						},
+					},
+					"localDiskFlag": false,
+				},
+			},
+		},
+	}
+}
+
+func testPreflightConfig() Config {
+	return Config{
+		DatacenterName:       "ams01",
+		BaseOsCode:           "CENTOS_6_64",
+		InstanceCpu:          1,
+		InstanceMemory:       1024,
+		InstanceNetworkSpeed: 10,
+		InstanceDiskCapacity: 25,
+	}
+}
+
+func TestPreflight_ValidConfig(t *testing.T) {
+	errs := validateCreateObjectOptions(testPreflightConfig(), testCreateObjectOptions())
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestPreflight_ReportsEveryInvalidValue(t *testing.T) {
+	config := testPreflightConfig()
+	config.DatacenterName = "ams99"
+	config.InstanceCpu = 3
+	config.InstanceMemory = 1000
+	config.InstanceNetworkSpeed = 1000
+	config.BaseOsCode = "CENTOS_5_64"
+	config.InstanceDiskCapacity = 50
+
+	errs := validateCreateObjectOptions(config, testCreateObjectOptions())
+	if len(errs) != 6 {
+		t.Fatalf("Expected 6 errors but got %d: %v", len(errs), errs)
+	}
+
+	expected := []string{
+		"Invalid datacenter_name 'ams99'. Valid choices are: ams01, dal10",
+		"Invalid instance_cpu '3'. Valid choices are: 1, 2, 4",
+		"Invalid instance_memory '1000'. Valid choices are: 1024, 2048",
+		"Invalid instance_network_speed '1000'. Valid choices are: 10, 100",
+		"Invalid base_os_code 'CENTOS_5_64'. Valid choices are: CENTOS_6_64",
+		"Invalid instance_disk_capacity '50'. Valid choices are: 25",
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Fatalf("Expected error '%s' but got '%s'", expected[i], err)
+		}
+	}
+}
+
+func TestPreflight_SkipsOsAndDiskForImages(t *testing.T) {
+	config := testPreflightConfig()
+	config.BaseOsCode = ""
+	config.BaseImageId = "some-image"
+	config.InstanceDiskCapacity = 1
+
+	errs := validateCreateObjectOptions(config, testCreateObjectOptions())
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+
+	config.InstanceCpu = 3
+	errs = validateCreateObjectOptions(config, testCreateObjectOptions())
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "instance_cpu") {
+		t.Fatalf("Expected a single instance_cpu error but got: %v", errs)
+	}
+}
+
+func TestPreflight_ImageDatacenters(t *testing.T) {
+	config := testPreflightConfig()
+	config.ImageDatacenters = []string{"dal10", "wdc07"}
+
+	errs := validateCreateObjectOptions(config, testCreateObjectOptions())
+	if len(errs) != 1 {
+		t.Fatalf("Expected a single error but got: %v", errs)
+	}
+
+	expected := "Invalid image_datacenters entry 'wdc07'. Valid choices are: ams01, dal10"
+	if errs[0].Error() != expected {
+		t.Fatalf("Expected error '%s' but got '%s'", expected, errs[0])
+	}
+}
+
+func TestPreflight_SkipsOptionsWithoutChoices(t *testing.T) {
+	options := testCreateObjectOptions()
+	delete(options, "memory")
+	options["processors"] = []interface{}{}
+
+	config := testPreflightConfig()
+	config.InstanceCpu = 3
+	config.InstanceMemory = 1000
+
+	errs := validateCreateObjectOptions(config, options)
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestPreflight_ResolveImageName(t *testing.T) {
+	images := []interface{}{
+		map[string]interface{}{"id": 1., "globalIdentifier": "a", "name": "golden"},
+		map[string]interface{}{"id": 2., "globalIdentifier": "b", "name": "golden-2"},
+		map[string]interface{}{"id": 3., "globalIdentifier": "c", "name": "golden"},
+		map[string]interface{}{"id": 4., "globalIdentifier": "d", "name": "silver"},
+	}
+
+	config := Config{ImageName: "bronze", ImageNameConflict: IMAGE_NAME_CONFLICT_ERROR}
+	name, replaced, err := resolveImageName(config, images)
+	if err != nil || name != "bronze" || len(replaced) != 0 {
+		t.Fatalf("Unexpected result for an unused name: '%s', %v, %v", name, replaced, err)
+	}
+
+	config.ImageName = "golden"
+	if _, _, err := resolveImageName(config, images); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	config.ImageNameConflict = IMAGE_NAME_CONFLICT_REPLACE
+	name, replaced, err = resolveImageName(config, images)
+	if err != nil || name != "golden" || len(replaced) != 2 {
+		t.Fatalf("Expected to replace two images but got: '%s', %v, %v", name, replaced, err)
+	}
+
+	if replaced[0]["globalIdentifier"] != "a" || replaced[1]["globalIdentifier"] != "c" {
+		t.Fatalf("Unexpected replaced images: %v", replaced)
+	}
+
+	config.ImageNameConflict = IMAGE_NAME_CONFLICT_SUFFIX
+	name, replaced, err = resolveImageName(config, images)
+	if err != nil || name != "golden-3" || len(replaced) != 0 {
+		t.Fatalf("Expected the name 'golden-3' but got: '%s', %v, %v", name, replaced, err)
+	}
+}
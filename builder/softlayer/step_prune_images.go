@@ -0,0 +1,72 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"log"
+	"time"
+)
+
+// stepPruneImages deletes the older images produced by the template, following the image_retention policy.
+type stepPruneImages struct{}
+
+func (self *stepPruneImages) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+	imageId := state.Get("image_id").(string)
+
+	if !config.ImageRetention.IsSet() {
+		return multistep.ActionContinue
+	}
+
+	ui.Say("Applying the image retention policy...")
+
+	// The new image is ready, so failing to prune the old ones shouldn't fail the build
+	images, err := client.getBlockDeviceTemplateGroups()
+	if err != nil {
+		log.Printf("Error listing images: %v", err.Error())
+		ui.Error("Error listing the images of the account. No image was pruned")
+		return multistep.ActionContinue
+	}
+
+	// Never prune the base image of the build, nor the replaced images already being deleted
+	var excludeIds []string
+	if baseImageId, ok := state.GetOk("base_image_id"); ok {
+		excludeIds = append(excludeIds, baseImageId.(string))
+	}
+	if replacedIds, ok := state.GetOk("replaced_image_ids"); ok {
+		excludeIds = append(excludeIds, replacedIds.([]string)...)
+	}
+
+	pruned := selectImagesToPrune(images, config.ImageRetention, time.Now(), imageId, excludeIds)
+	if len(pruned) == 0 {
+		ui.Message("No image to prune")
+		return multistep.ActionContinue
+	}
+
+	for _, image := range pruned {
+		prunedId := image["globalIdentifier"].(string)
+		description := fmt.Sprintf("%s (%v, created %v)", prunedId, image["name"], image["createDate"])
+
+		if config.ImageRetention.DryRun {
+			ui.Message(fmt.Sprintf("Would delete image %s", description))
+			continue
+		}
+
+		err := client.deleteImage(int64(image["id"].(float64)))
+		if err != nil {
+			log.Printf("Error deleting pruned image: %v", err.Error())
+			ui.Error(fmt.Sprintf("Error deleting the image. Please delete the image (%s) manually", prunedId))
+			continue
+		}
+
+		ui.Message(fmt.Sprintf("Deleted image %s", description))
+	}
+
+	return multistep.ActionContinue
+}
+
+func (self *stepPruneImages) Cleanup(state multistep.StateBag) {
+}
@@ -0,0 +1,42 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"log"
+)
+
+// stepReplaceImages deletes the existing images with the same name as the new image,
+// when image_name_conflict is 'replace'.
+type stepReplaceImages struct{}
+
+func (self *stepReplaceImages) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	ui := state.Get("ui").(packer.Ui)
+
+	var replacedIds []string
+	for _, image := range state.Get("replaced_images").([]map[string]interface{}) {
+		imageId := image["globalIdentifier"].(string)
+		templateGroupId := int64(image["id"].(float64))
+
+		ui.Say(fmt.Sprintf("Deleting the replaced image (%s)...", imageId))
+		err := client.deleteImage(templateGroupId)
+		if err != nil {
+			// The new image is ready, so failing to delete an old one shouldn't fail the build
+			log.Printf("Error deleting replaced image: %v", err.Error())
+			ui.Error(fmt.Sprintf("Error deleting the replaced image. Please delete the image (%s) manually", imageId))
+			continue
+		}
+
+		replacedIds = append(replacedIds, imageId)
+	}
+
+	// SoftLayer deletes the images asynchronously, they are still listed for a while
+	state.Put("replaced_image_ids", replacedIds)
+
+	return multistep.ActionContinue
+}
+
+func (self *stepReplaceImages) Cleanup(state multistep.StateBag) {
+}
@@ -0,0 +1,49 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"log"
+)
+
+// stepResolveBaseImage looks up the image selected by the base_image_filter.
+type stepResolveBaseImage struct{}
+
+func (self *stepResolveBaseImage) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	if !config.BaseImageFilter.IsSet() {
+		return multistep.ActionContinue
+	}
+
+	ui.Say("Looking up the base image...")
+
+	images, err := client.getBlockDeviceTemplateGroups()
+	if err != nil {
+		err := fmt.Errorf("Error listing the images of the account: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	image, err := findMatchingImage(images, config.BaseImageFilter)
+	if err != nil {
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	imageId := image["globalIdentifier"].(string)
+	log.Printf("Resolved base_image_filter to image %s (%v)", imageId, image["name"])
+	ui.Say(fmt.Sprintf("Using base image '%v', id: '%s'", image["name"], imageId))
+
+	state.Put("base_image_id", imageId)
+
+	return multistep.ActionContinue
+}
+
+func (self *stepResolveBaseImage) Cleanup(state multistep.StateBag) {
+}
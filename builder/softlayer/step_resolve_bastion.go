@@ -0,0 +1,49 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/helper/communicator"
+	"github.com/mitchellh/packer/packer"
+)
+
+// stepResolveBastion looks the bastion up when ssh_bastion_lookup is set, and points the communicator at it.
+type stepResolveBastion struct {
+	Comm *communicator.Config
+}
+
+func (self *stepResolveBastion) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	if !config.SSHBastionLookup.IsSet() {
+		return multistep.ActionContinue
+	}
+
+	ui.Say("Looking up the bastion instance...")
+
+	guests, err := client.getVirtualGuests()
+	if err != nil {
+		err := fmt.Errorf("Error listing the instances of the account: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	address, err := findBastionAddress(guests, config.SSHBastionLookup)
+	if err != nil {
+		err := fmt.Errorf("Error looking up the bastion: %s", err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	ui.Message(fmt.Sprintf("Connecting through the bastion at %s", address))
+	self.Comm.SSHBastionHost = address
+
+	return multistep.ActionContinue
+}
+
+func (self *stepResolveBastion) Cleanup(state multistep.StateBag) {
+}
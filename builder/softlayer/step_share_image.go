@@ -0,0 +1,97 @@
+package softlayer
+
+import (
+	"fmt"
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"log"
+)
+
+// stepShareImage gives the image_share_accounts access to the captured image.
+type stepShareImage struct{}
+
+func (self *stepShareImage) Run(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*SoftlayerClient)
+	config := state.Get("config").(Config)
+	ui := state.Get("ui").(packer.Ui)
+	imageId := state.Get("image_id").(string)
+	templateGroupId := state.Get("image_template_group_id").(int64)
+
+	if len(config.ImageShareAccounts) == 0 {
+		return multistep.ActionContinue
+	}
+
+	var sharedAccounts []int
+	for _, accountId := range config.ImageShareAccounts {
+		ui.Say(fmt.Sprintf("Sharing image (%s) with account %d...", imageId, accountId))
+		err := client.permitImageSharing(templateGroupId, accountId)
+		if err != nil {
+			err := fmt.Errorf("Error sharing image (%s) with account %d: %s", imageId, accountId, err)
+			ui.Error(err.Error())
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+
+		// Record every account as soon as it got access, so it can be revoked later on
+		sharedAccounts = append(sharedAccounts, accountId)
+		state.Put("image_shared_accounts", sharedAccounts)
+	}
+
+	// Make sure SoftLayer actually recorded the access for every account
+	accountIds, err := client.getImageSharedAccounts(templateGroupId)
+	if err != nil {
+		err := fmt.Errorf("Error verifying the accounts image (%s) is shared with: %s", imageId, err)
+		ui.Error(err.Error())
+		state.Put("error", err)
+		return multistep.ActionHalt
+	}
+
+	for _, accountId := range config.ImageShareAccounts {
+		if !containsInt(accountIds, accountId) {
+			err := fmt.Errorf("Image (%s) isn't shared with account %d although SoftLayer accepted the request", imageId, accountId)
+			ui.Error(err.Error())
+			state.Put("error", err)
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (self *stepShareImage) Cleanup(state multistep.StateBag) {
+	sharedAccounts, ok := state.GetOk("image_shared_accounts")
+	if !ok {
+		return
+	}
+
+	// A successful build hands the shared image over in the artifact
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if !cancelled && !halted {
+		return
+	}
+
+	client := state.Get("client").(*SoftlayerClient)
+	ui := state.Get("ui").(packer.Ui)
+	imageId := state.Get("image_id").(string)
+	templateGroupId := state.Get("image_template_group_id").(int64)
+
+	for _, accountId := range sharedAccounts.([]int) {
+		ui.Say(fmt.Sprintf("Stopping to share image (%s) with account %d...", imageId, accountId))
+		err := client.denyImageSharing(templateGroupId, accountId)
+		if err != nil {
+			log.Printf("Error stopping to share image: %v", err.Error())
+			ui.Error(fmt.Sprintf("Error stopping to share image (%s). Please revoke the access of account %d manually", imageId, accountId))
+		}
+	}
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"github.com/leonidlm/packer-builder-softlayer/builder/softlayer"
 	"github.com/mitchellh/packer/packer/plugin"
+	"os"
+	"time"
 )
 
 func main() {
+	// The plugin binary can also be run by hand to clean up after crashed builds
+	if len(os.Args) > 1 && os.Args[1] == "cleanup" {
+		os.Exit(cleanup(os.Args[2:]))
+	}
+
 	server, err := plugin.Server()
 	if err != nil {
 		panic(err)
@@ -13,3 +22,41 @@ func main() {
 	server.RegisterBuilder(new(softlayer.Builder))
 	server.Serve()
 }
+
+// cleanup deletes the resources of crashed builds once they expired, and returns the exit code.
+func cleanup(args []string) int {
+	flags := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "Only list the expired resources")
+	instanceNamePrefix := flags.String("instance-name-prefix", softlayer.DEFAULT_INSTANCE_NAME_PREFIX,
+		"The instance_name_prefix of the builds, to find the instances left untagged")
+	untaggedTTL := flags.String("untagged-ttl", softlayer.DEFAULT_RESOURCE_TTL,
+		"How long after its creation an untagged instance named after the prefix expires")
+	flags.Parse(args)
+
+	ttl, err := time.ParseDuration(*untaggedTTL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed parsing -untagged-ttl: %s\n", err)
+		return 1
+	}
+
+	username := os.Getenv("SOFTLAYER_USER_NAME")
+	apiKey := os.Getenv("SOFTLAYER_API_KEY")
+	if username == "" || apiKey == "" {
+		fmt.Fprintln(os.Stderr, "The SOFTLAYER_USER_NAME and SOFTLAYER_API_KEY environment variables must be set")
+		return 1
+	}
+
+	options := softlayer.CleanupOptions{
+		DryRun:             *dryRun,
+		InstanceNamePrefix: *instanceNamePrefix,
+		UntaggedTTL:        ttl,
+	}
+
+	err = softlayer.CleanupExpiredResources(username, apiKey, options, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}